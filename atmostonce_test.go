@@ -0,0 +1,80 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubAtMostOnce(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	// revisitingTraverser reaches the node at [1] twice.
+	revisitingTraverser := func(interface{}) pubsub.Paths {
+		return pubsub.PathAndTraversers([]pubsub.PathAndTraverser{
+			{Path: 1, Traverser: pubsub.LinearTreeTraverser([]uint64{2})},
+			{Path: 1, Traverser: pubsub.LinearTreeTraverser([]uint64{3})},
+		})
+	}
+
+	o.Spec("it delivers for each time a node is reached by default", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("data", revisitingTraverser)
+
+		Expect(t, t.subscription.data).To(HaveLen(2))
+	})
+
+	o.Spec("it delivers at most once to an opted in subscription", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithAtMostOnce())
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("data", revisitingTraverser)
+		t.p.Publish("data", revisitingTraverser)
+
+		Expect(t, t.subscription.data).To(HaveLen(2))
+		Expect(t, other.data).To(HaveLen(4))
+	})
+
+	o.Spec("it delivers at most once to each node", func(t TPS) {
+		p := pubsub.New(pubsub.WithAtMostOnceDelivery())
+		shard1, f1 := newSpySubscrption()
+		shard2, f2 := newSpySubscrption()
+		p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+		p.Subscribe(f1, pubsub.WithPath([]uint64{1}), pubsub.WithShardID("a"))
+		p.Subscribe(f2, pubsub.WithPath([]uint64{1}), pubsub.WithShardID("a"))
+
+		for i := 0; i < 10; i++ {
+			p.Publish("data", revisitingTraverser)
+		}
+
+		Expect(t, t.subscription.data).To(HaveLen(10))
+		Expect(t, len(shard1.data)+len(shard2.data)).To(Equal(10))
+	})
+
+	o.Spec("it explains revisited nodes", func(t TPS) {
+		p := pubsub.New(pubsub.WithAtMostOnceDelivery())
+		p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		trace := p.Explain("data", revisitingTraverser)
+
+		Expect(t, trace.Reached()).To(Equal(1))
+		Expect(t, trace.String()).To(ContainSubstring("[1] revisited"))
+	})
+}
@@ -0,0 +1,188 @@
+package pubsub
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// SubscribeBatch is like Subscribe, but the subscription is handed every
+// item of a PublishBatch that reaches it at once, in the order they were
+// published. Data published with Publish is handed over as a single item.
+// A subscription configured WithBuffer is handed one item at a time.
+func (s *Typed[T]) SubscribeBatch(sub func(data []T), opts ...SubscribeOption) Unsubscriber {
+	c := newSubscribeConfig(opts)
+	return s.add(newSubscription(nil, func(_ context.Context, data []T) error {
+		sub(data)
+		return nil
+	}, c, s.pubsubConfig), c).unsubscriber()
+}
+
+// PublishBatch publishes each of the items as if it was published with
+// Publish and the given TreeTraverser. The read lock is only acquired once
+// for the whole batch. Each item traverses the subscription tree, and only
+// then are the items delivered, without holding the lock. Every item still
+// runs the TreeTraverser and its own lookups in the tree, which is most of
+// the cost of a publish, so a batch costs about as much per item as
+// Publish. Deliveries are
+// grouped per subscription: each subscription is handed all of the items
+// that reached it, in order, before the next subscription is invoked. A
+// subscription that subscribed with SubscribeBatch is invoked once with all
+// of its items. The publish interceptors wrap the whole batch (see
+// WithPublishInterceptor).
+func (s *Typed[T]) PublishBatch(items []T, a TypedTreeTraverser[T]) {
+	if len(s.publishInterceptors) == 0 {
+		s.publishBatch(context.Background(), items, a)
+		return
+	}
+
+	s.intercept(context.Background(), items, func(ctx context.Context, data interface{}) {
+		s.publishBatch(ctx, intercepted[[]T](data), a)
+	})
+}
+
+// publishBatch traverses the subscription tree with each item and then
+// delivers them with the context.
+func (s *Typed[T]) publishBatch(ctx context.Context, items []T, a TypedTreeTraverser[T]) {
+	b := &batch[T]{
+		index: make(map[*subscription[T]]int),
+	}
+	s.matchBatch(b, items, a)
+	b.expireAll()
+
+	for _, t := range b.targets {
+		t.sub.deliverBatch(ctx, t.items, t.seqs)
+	}
+}
+
+// matchBatch records each item in the history and traverses the
+// subscription tree with it while holding the read lock.
+func (s *Typed[T]) matchBatch(b *batch[T], items []T, a TypedTreeTraverser[T]) {
+	s.rlock()
+	defer s.runlock()
+
+	seqs := make([]uint64, len(items))
+	for i, d := range items {
+		seqs[i] = s.record(d, a)
+	}
+
+	root := s.root.Load()
+	for i, d := range items {
+		b.seen = seen{}
+		b.candidates = candidates{}
+		b.current = d
+		b.currentSeq = seqs[i]
+		b.depth, b.visited = 0, 0
+		s.route(b, d, a, root, nil)
+		s.published(b.depth, b.visited)
+	}
+}
+
+// batch is the visitor used by PublishBatch. It collects the items that
+// reach each subscription.
+type batch[T any] struct {
+	seen
+	candidates
+	expiries[T]
+
+	current    T
+	currentSeq uint64
+	index      map[*subscription[T]]int
+	targets    []batchTarget[T]
+
+	// depth and visited describe the current item's traversal.
+	depth   int
+	visited int
+}
+
+// batchTarget is a subscription and the items that reached it.
+type batchTarget[T any] struct {
+	sub   *subscription[T]
+	items []T
+	seqs  []uint64
+}
+
+// selects implements visitor.
+func (b *batch[T]) selects() bool {
+	return true
+}
+
+// stopped implements visitor.
+func (b *batch[T]) stopped() bool {
+	return false
+}
+
+// visit implements visitor. It counts the nodes the current item visits
+// and tracks the depth of the deepest one.
+func (b *batch[T]) visit(_ []uint64, depth int, _ node.Pattern, n *node.Node) {
+	if n == nil {
+		return
+	}
+
+	b.visited++
+	if depth > b.depth {
+		b.depth = depth
+	}
+}
+
+// reach implements visitor. It records the current item for the envelope's
+// subscription.
+func (b *batch[T]) reach(e node.SubscriptionEnvelope, _ string, _, _ int) {
+	sub := e.Meta.(*subscription[T])
+
+	i, ok := b.index[sub]
+	if !ok {
+		i = len(b.targets)
+		b.index[sub] = i
+		b.targets = append(b.targets, batchTarget[T]{sub: sub})
+	}
+
+	b.targets[i].items = append(b.targets[i].items, b.current)
+	b.targets[i].seqs = append(b.targets[i].seqs, b.currentSeq)
+}
+
+// reachGroup implements visitor.
+func (b *batch[T]) reachGroup(_ string, _ []uint64, e node.SubscriptionEnvelope, idx, size int) {
+	b.reach(e, "", idx, size)
+}
+
+// deliverBatch hands the items to the subscriber. A batch subscription
+// without a buffer is invoked once with every item. Any other subscription,
+// or one that replays the history, is handed one item at a time.
+func (s *subscription[T]) deliverBatch(ctx context.Context, ds []T, seqs []uint64) {
+	if s.batch == nil || s.buffer != nil || s.gate != nil {
+		for i, d := range ds {
+			s.deliverLive(ctx, d, seqs[i])
+		}
+		return
+	}
+
+	if s.isRemoved() {
+		return
+	}
+
+	n, last := s.take(len(ds))
+	if n == 0 {
+		return
+	}
+	ds = ds[:n]
+	if last {
+		defer s.expire(RemovedByMaxDeliveries)
+	}
+
+	if s.tracked {
+		s.begin()
+		defer s.end()
+	}
+
+	if s.recoverPanics {
+		defer s.recoverPanic(ds, true)
+	}
+
+	err := s.measure(true, func() error {
+		return s.callBatch(ctx, ds)
+	})
+	if err != nil {
+		s.deadLetter(ds, err)
+	}
+}
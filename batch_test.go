@@ -0,0 +1,135 @@
+package pubsub_test
+
+import (
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubBatch(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	// valueTraverser uses the published int as the path.
+	valueTraverser := func(data interface{}) pubsub.Paths {
+		return pubsub.FlatPaths([]uint64{uint64(data.(int))})
+	}
+
+	o.Spec("it delivers each item", func(t TPS) {
+		odd, f := newSpySubscrption()
+		t.p.Subscribe(t.sub)
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+
+		t.p.PublishBatch([]interface{}{1, 2, 1}, valueTraverser)
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1, 2, 1}))
+		Expect(t, odd.data).To(Equal([]interface{}{1, 1}))
+	})
+
+	o.Spec("it groups deliveries per subscription", func(t TPS) {
+		var order []string
+		t.p.Subscribe(func(data interface{}) {
+			order = append(order, "a")
+		})
+		t.p.Subscribe(func(data interface{}) {
+			order = append(order, "b")
+		})
+
+		t.p.PublishBatch([]interface{}{1, 2}, valueTraverser)
+
+		Expect(t, order).To(Equal([]string{"a", "a", "b", "b"}))
+	})
+
+	o.Spec("it hands a batch subscription all of its items at once", func(t TPS) {
+		var batches [][]interface{}
+		t.p.SubscribeBatch(func(data []interface{}) {
+			batches = append(batches, data)
+		}, pubsub.WithPath([]uint64{1}))
+
+		t.p.PublishBatch([]interface{}{1, 2, 1}, valueTraverser)
+		t.p.Publish(1, valueTraverser)
+
+		Expect(t, batches).To(Equal([][]interface{}{{1, 1}, {1}}))
+	})
+
+	o.Spec("it does not invoke a batch subscription that was not reached", func(t TPS) {
+		var called bool
+		t.p.SubscribeBatch(func([]interface{}) {
+			called = true
+		}, pubsub.WithPath([]uint64{3}))
+
+		t.p.PublishBatch([]interface{}{1, 2}, valueTraverser)
+
+		Expect(t, called).To(BeFalse())
+	})
+
+	o.Spec("it selects a shard per item", func(t TPS) {
+		p := pubsub.New(pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+			return uint64(data.(int))
+		}))
+		a, fa := newSpySubscrption()
+		b, fb := newSpySubscrption()
+		p.Subscribe(fa, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("a"))
+		p.Subscribe(fb, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("b"))
+
+		p.PublishBatch([]interface{}{1, 2, 3, 4}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, len(a.data)+len(b.data)).To(Equal(4))
+		Expect(t, a.data).To(HaveLen(2))
+	})
+
+	o.Spec("it hands the whole batch to the DeadLetterHandler", func(t TPS) {
+		handler := &spyDeadLetterHandler{}
+		p := pubsub.New(pubsub.WithPanicRecovery(), pubsub.WithDeadLetterHandler(handler.handle))
+		p.SubscribeBatch(func([]interface{}) {
+			panic(errors.New("some-error"))
+		})
+
+		p.PublishBatch([]interface{}{1, 2}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, handler.letters).To(HaveLen(1))
+		Expect(t, handler.letters[0].Data).To(Equal([]interface{}{1, 2}))
+	})
+
+	o.Spec("it does not deliver to subscriptions removed during the batch", func(t TPS) {
+		var unsubscribe pubsub.Unsubscriber
+		t.p.Subscribe(func(interface{}) {
+			unsubscribe()
+		})
+		unsubscribe = t.p.Subscribe(t.sub)
+
+		t.p.PublishBatch([]interface{}{1, 2}, valueTraverser)
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(1))
+	})
+
+	o.Spec("it releases the read lock if the traverser panics", func(t TPS) {
+		Expect(t, func() {
+			t.p.PublishBatch([]interface{}{1}, func(interface{}) pubsub.Paths {
+				panic("some-panic")
+			})
+		}).To(Panic())
+
+		t.p.Subscribe(t.sub)
+		t.p.PublishBatch([]interface{}{1}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(1))
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1}))
+	})
+}
@@ -92,6 +92,34 @@ func BenchmarkPublishingParallelStructs(b *testing.B) {
 	})
 }
 
+func BenchmarkPublishingBatchParallelStructs(b *testing.B) {
+	b.StopTimer()
+	p := pubsub.New()
+	for i := 0; i < 100; i++ {
+		_, f := newSpySubscrption()
+		p.Subscribe(f, pubsub.WithPath(randPath()))
+	}
+	data := randStructs()
+	st := StructTraverser{}
+	b.StartTimer()
+
+	// Each iteration publishes a single item, in batches of 100, so it
+	// compares per item with BenchmarkPublishingParallelStructs.
+	b.RunParallel(func(b *testing.PB) {
+		i := rand.Int() //nolint:gosec
+		batch := make([]interface{}, 0, 100)
+		for b.Next() {
+			batch = append(batch, data[i%len(data)])
+			if len(batch) == cap(batch) {
+				p.PublishBatch(batch, st.traverse)
+				batch = batch[:0]
+			}
+			i++
+		}
+		p.PublishBatch(batch, st.traverse)
+	})
+}
+
 func BenchmarkPublishingWhileSubscribing(b *testing.B) {
 	b.StopTimer()
 	p := pubsub.New()
@@ -156,6 +184,88 @@ func BenchmarkPublishingWhileSubscribingStructs(b *testing.B) {
 	})
 }
 
+func BenchmarkPublishingParallelCopyOnWrite(b *testing.B) {
+	b.StopTimer()
+	p := pubsub.New(pubsub.WithCopyOnWrite())
+	for i := 0; i < 100; i++ {
+		_, f := newSpySubscrption()
+		p.Subscribe(f, pubsub.WithPath(randPath()))
+	}
+	b.StartTimer()
+
+	b.RunParallel(func(b *testing.PB) {
+		i := rand.Int() //nolint:gosec
+		for b.Next() {
+			p.Publish("data", pubsub.LinearTreeTraverser(randPath()))
+			i++
+		}
+	})
+}
+
+func BenchmarkPublishingWhileSubscribingCopyOnWrite(b *testing.B) {
+	b.StopTimer()
+	p := pubsub.New(pubsub.WithCopyOnWrite())
+	done := subscribeWhileBenchmarking(p)
+	defer close(done)
+	b.StartTimer()
+
+	b.RunParallel(func(b *testing.PB) {
+		i := rand.Int() //nolint:gosec
+		for b.Next() {
+			p.Publish("data", pubsub.LinearTreeTraverser(randPath()))
+			i++
+		}
+	})
+}
+
+func BenchmarkPublishingWhileSubscribingStructsCopyOnWrite(b *testing.B) {
+	b.StopTimer()
+	p := pubsub.New(pubsub.WithCopyOnWrite())
+	data := randStructs()
+	done := subscribeWhileBenchmarking(p)
+	defer close(done)
+	st := StructTraverser{}
+	b.StartTimer()
+
+	b.RunParallel(func(b *testing.PB) {
+		i := rand.Int() //nolint:gosec
+		for b.Next() {
+			p.Publish(data[i%len(data)], st.traverse)
+			i++
+		}
+	})
+}
+
+// subscribeWhileBenchmarking subscribes and unsubscribes from several
+// goroutines until the returned channel is closed.
+func subscribeWhileBenchmarking(p *pubsub.PubSub) chan struct{} {
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for x := 0; x < 5; x++ {
+		wg.Add(1)
+		go func() {
+			wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				_, f := newSpySubscrption()
+				unsub := p.Subscribe(f, pubsub.WithPath(randPath()))
+				if i%2 == 0 {
+					unsub()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return done
+}
+
 func randPath() []uint64 {
 	var r []uint64
 	for i := 0; i < 10; i++ {
@@ -0,0 +1,216 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DropPolicy decides what a buffered subscription does with newly published
+// data when its buffer is full. It is used with WithBuffer.
+type DropPolicy struct {
+	dropOldest bool
+	block      bool
+	timeout    time.Duration
+}
+
+// DropNewest returns a DropPolicy that discards the data being published
+// when the buffer is full. The buffered data is left untouched.
+func DropNewest() DropPolicy {
+	return DropPolicy{}
+}
+
+// DropOldest returns a DropPolicy that discards the oldest buffered data
+// to make room for the data being published.
+func DropOldest() DropPolicy {
+	return DropPolicy{dropOldest: true}
+}
+
+// BlockWithTimeout returns a DropPolicy that blocks the publisher until
+// there is room in the buffer. If there is still no room after the timeout,
+// the data being published is discarded.
+func BlockWithTimeout(timeout time.Duration) DropPolicy {
+	return DropPolicy{block: true, timeout: timeout}
+}
+
+// WithBuffer configures a subscription to be invoked asynchronously. Each
+// published data point is stored in a ring buffer of the given size and the
+// subscription is invoked from its own goroutine. The DropPolicy decides
+// what happens when the buffer is full. The goroutine exits and any
+// buffered data is discarded when the subscription unsubscribes. A size
+// less than 1 is ignored.
+func WithBuffer(size int, policy DropPolicy) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.bufferSize = size
+		c.dropPolicy = policy
+	})
+}
+
+// WithDropHandler configures a buffered subscription to report dropped data.
+// The given function is invoked with the number of data points that were
+// dropped each time the DropPolicy discards data. It is invoked on the
+// publisher's goroutine and should therefore be quick.
+func WithDropHandler(f func(dropped int)) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.dropHandler = f
+	})
+}
+
+// buffer is a fixed size ring buffer that sits between publishers and a
+// subscription. It is drained by a single goroutine (see run).
+type buffer[T any] struct {
+	mu     sync.Mutex
+	data   []bufferedData[T]
+	start  int
+	len    int
+	policy DropPolicy
+	onDrop func(int)
+
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// bufferedData is the data and the context it was published with.
+type bufferedData[T any] struct {
+	ctx  context.Context
+	data T
+}
+
+func newBuffer[T any](size int, policy DropPolicy, onDrop func(int)) *buffer[T] {
+	if onDrop == nil {
+		onDrop = func(int) {}
+	}
+
+	return &buffer[T]{
+		data:     make([]bufferedData[T], size),
+		policy:   policy,
+		onDrop:   onDrop,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// write stores the data in the buffer, applying the DropPolicy if the
+// buffer is full.
+func (b *buffer[T]) write(ctx context.Context, d T) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	b.mu.Lock()
+	for b.len == len(b.data) {
+		if b.stopped() {
+			b.mu.Unlock()
+			return
+		}
+
+		switch {
+		case b.policy.dropOldest:
+			b.pop()
+			b.mu.Unlock()
+			b.onDrop(1)
+			b.mu.Lock()
+			continue
+		case b.policy.block:
+			b.mu.Unlock()
+			if timer == nil {
+				timer = time.NewTimer(b.policy.timeout)
+			}
+
+			select {
+			case <-b.notFull:
+			case <-b.done:
+				return
+			case <-timer.C:
+				b.onDrop(1)
+				return
+			}
+
+			b.mu.Lock()
+			continue
+		default:
+			b.mu.Unlock()
+			b.onDrop(1)
+			return
+		}
+	}
+
+	b.data[(b.start+b.len)%len(b.data)] = bufferedData[T]{ctx: ctx, data: d}
+	b.len++
+	b.mu.Unlock()
+
+	signal(b.notEmpty)
+}
+
+// run invokes f with each buffered data point until the buffer is stopped.
+func (b *buffer[T]) run(f func(ctx context.Context, data T)) {
+	for {
+		b.mu.Lock()
+		if b.len == 0 {
+			b.mu.Unlock()
+			select {
+			case <-b.notEmpty:
+				continue
+			case <-b.done:
+				return
+			}
+		}
+
+		d := b.pop()
+		b.mu.Unlock()
+		signal(b.notFull)
+
+		if b.stopped() {
+			return
+		}
+
+		f(d.ctx, d.data)
+	}
+}
+
+// stop makes run return and discards any further writes. It is safe to
+// invoke several times.
+func (b *buffer[T]) stop() {
+	b.stopOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+func (b *buffer[T]) stopped() bool {
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// size returns the number of buffered data points.
+func (b *buffer[T]) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.len
+}
+
+// pop removes the oldest data point. It must be invoked while holding mu.
+func (b *buffer[T]) pop() bufferedData[T] {
+	d := b.data[b.start]
+	b.data[b.start] = bufferedData[T]{}
+	b.start = (b.start + 1) % len(b.data)
+	b.len--
+	return d
+}
+
+// signal does a non-blocking send on a channel with a capacity of 1.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,154 @@
+package pubsub_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TB struct {
+	*testing.T
+	p       *pubsub.PubSub
+	sub     *blockingSubscription
+	dropped *int64
+}
+
+func TestPubSubWithBuffer(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TB {
+		return TB{
+			T:       t,
+			p:       pubsub.New(),
+			sub:     newBlockingSubscription(),
+			dropped: new(int64),
+		}
+	})
+
+	o.Spec("it does not block the publisher on a slow subscription", func(t TB) {
+		t.p.Subscribe(t.sub.f, pubsub.WithBuffer(1, pubsub.DropNewest()))
+		defer t.sub.release()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 10; i++ {
+				t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+			}
+		}()
+
+		Expect(t, done).To(ViaPolling(BeClosed()))
+	})
+
+	o.Spec("it drops the newest data when full", func(t TB) {
+		t.p.Subscribe(t.sub.f,
+			pubsub.WithBuffer(2, pubsub.DropNewest()),
+			pubsub.WithDropHandler(t.onDrop),
+		)
+
+		t.publishWhileBlocked(5)
+
+		Expect(t, atomic.LoadInt64(t.dropped)).To(Equal(int64(2)))
+		Expect(t, t.sub.received).To(ViaPolling(Equal([]interface{}{0, 1, 2})))
+	})
+
+	o.Spec("it drops the oldest data when full", func(t TB) {
+		t.p.Subscribe(t.sub.f,
+			pubsub.WithBuffer(2, pubsub.DropOldest()),
+			pubsub.WithDropHandler(t.onDrop),
+		)
+
+		t.publishWhileBlocked(5)
+
+		Expect(t, atomic.LoadInt64(t.dropped)).To(Equal(int64(2)))
+		Expect(t, t.sub.received).To(ViaPolling(Equal([]interface{}{0, 3, 4})))
+	})
+
+	o.Spec("it blocks until the timeout when full", func(t TB) {
+		t.p.Subscribe(t.sub.f,
+			pubsub.WithBuffer(1, pubsub.BlockWithTimeout(10*time.Millisecond)),
+			pubsub.WithDropHandler(t.onDrop),
+		)
+
+		start := time.Now()
+		t.publishWhileBlocked(3)
+
+		Expect(t, time.Since(start) >= 10*time.Millisecond).To(BeTrue())
+		Expect(t, atomic.LoadInt64(t.dropped)).To(Equal(int64(1)))
+		Expect(t, t.sub.received).To(ViaPolling(Equal([]interface{}{0, 1})))
+	})
+
+	o.Spec("it stops delivering after unsubscribing", func(t TB) {
+		unsubscribe := t.p.Subscribe(t.sub.f, pubsub.WithBuffer(5, pubsub.DropNewest()))
+
+		t.publishWhileBlocked(1)
+		Expect(t, t.sub.received).To(ViaPolling(HaveLen(1)))
+		unsubscribe()
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.sub.received).To(Always(HaveLen(1)))
+	})
+}
+
+// publishWhileBlocked publishes the first data point and waits for the
+// subscription to block on it. It then publishes the remaining data points
+// before releasing the subscription.
+func (t TB) publishWhileBlocked(count int) {
+	t.p.Publish(0, pubsub.LinearTreeTraverser(nil))
+	Expect(t, t.sub.started).To(ViaPolling(Receive()))
+
+	for i := 1; i < count; i++ {
+		t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+	}
+	t.sub.release()
+}
+
+func (t TB) onDrop(dropped int) {
+	atomic.AddInt64(t.dropped, int64(dropped))
+}
+
+type blockingSubscription struct {
+	mu      sync.Mutex
+	data    []interface{}
+	started chan struct{}
+	blocker chan struct{}
+	once    sync.Once
+}
+
+func newBlockingSubscription() *blockingSubscription {
+	return &blockingSubscription{
+		started: make(chan struct{}, 1),
+		blocker: make(chan struct{}),
+	}
+}
+
+func (s *blockingSubscription) f(data interface{}) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.blocker
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append(s.data, data)
+}
+
+func (s *blockingSubscription) release() {
+	s.once.Do(func() {
+		close(s.blocker)
+	})
+}
+
+func (s *blockingSubscription) received() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]interface{}(nil), s.data...)
+}
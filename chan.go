@@ -0,0 +1,63 @@
+package pubsub
+
+import (
+	"context"
+	"iter"
+)
+
+// SubscribeChan is like Subscribe, but the data is sent to the returned
+// channel instead of being handed to a callback. The data is buffered (see
+// WithBuffer) between the publishers and the channel, so a receiver that
+// falls behind never blocks a publisher. The buffer holds buf data points,
+// or 1 if buf is less than 1. When the buffer is full, the data being
+// published is dropped. A WithBuffer option configures another DropPolicy,
+// while its size is ignored. WithDropHandler reports the dropped data.
+//
+// The channel is closed once the subscription is removed, be it by the
+// Unsubscriber or automatically (see WithContext). Any data that was not
+// received by then is discarded.
+func (s *Typed[T]) SubscribeChan(buf int, opts ...SubscribeOption) (<-chan T, Unsubscriber) {
+	c := newSubscribeConfig(opts)
+	if buf < 1 {
+		buf = 1
+	}
+	c.bufferSize = buf
+
+	ch := make(chan T)
+	c.bufferStopped = func() {
+		close(ch)
+	}
+
+	// ss is set before any data can be published to it.
+	var ss *subscription[T]
+	ss = newSubscription(func(_ context.Context, d T) error {
+		select {
+		case ch <- d:
+		case <-ss.buffer.done:
+		}
+		return nil
+	}, nil, c, s.pubsubConfig)
+
+	return ch, s.add(ss, c).unsubscriber()
+}
+
+// SubscribeSeq is like SubscribeChan, but the data is yielded by the
+// returned iter.Seq. The subscription is made right away, so no data is
+// missed before the iteration starts. The iteration ends once the context
+// is done or the subscription is otherwise removed (see WithTTL and
+// WithMaxDeliveries). The subscription is removed when the loop is exited
+// early. The iter.Seq can only be iterated once.
+func (s *Typed[T]) SubscribeSeq(ctx context.Context, buf int, opts ...SubscribeOption) iter.Seq[T] {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx))
+	ch, unsubscribe := s.SubscribeChan(buf, opts...)
+
+	return func(yield func(T) bool) {
+		defer unsubscribe()
+
+		for d := range ch {
+			if !yield(d) {
+				return
+			}
+		}
+	}
+}
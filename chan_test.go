@@ -0,0 +1,158 @@
+package pubsub_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TC struct {
+	*testing.T
+	p *pubsub.PubSub
+}
+
+func TestPubSubChannels(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TC {
+		return TC{
+			T: t,
+			p: pubsub.New(),
+		}
+	})
+
+	// receiveAll receives from the channel until nothing is sent for a
+	// while.
+	receiveAll := func(ch <-chan interface{}) []interface{} {
+		var ds []interface{}
+		for {
+			select {
+			case d, ok := <-ch:
+				if !ok {
+					return ds
+				}
+				ds = append(ds, d)
+			case <-time.After(100 * time.Millisecond):
+				return ds
+			}
+		}
+	}
+
+	o.Spec("it sends the data to the channel in order", func(t TC) {
+		ch, _ := t.p.SubscribeChan(10, pubsub.WithPath([]uint64{1}))
+
+		for i := 0; i < 5; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser([]uint64{1}))
+		}
+		t.p.Publish(5, pubsub.LinearTreeTraverser([]uint64{2}))
+
+		Expect(t, receiveAll(ch)).To(Equal([]interface{}{0, 1, 2, 3, 4}))
+	})
+
+	o.Spec("it closes the channel on unsubscribe", func(t TC) {
+		ch, unsubscribe := t.p.SubscribeChan(1)
+
+		unsubscribe()
+
+		Expect(t, ch).To(ViaPolling(BeClosed()))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it closes the channel once the context is done", func(t TC) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, _ := t.p.SubscribeChan(1, pubsub.WithContext(ctx))
+
+		cancel()
+
+		Expect(t, ch).To(ViaPolling(BeClosed()))
+	})
+
+	o.Spec("it drops data when the buffer is full", func(t TC) {
+		var dropped int64
+		ch, _ := t.p.SubscribeChan(2, pubsub.WithDropHandler(func(n int) {
+			atomic.AddInt64(&dropped, int64(n))
+		}))
+
+		for i := 0; i < 10; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		// One data point may already be waiting to be sent.
+		received := receiveAll(ch)
+		Expect(t, len(received)).To(BeBelow(4))
+		Expect(t, len(received)+int(atomic.LoadInt64(&dropped))).To(Equal(10))
+		Expect(t, received[0]).To(Equal(0))
+	})
+
+	o.Spec("it keeps the oldest data with DropOldest", func(t TC) {
+		ch, _ := t.p.SubscribeChan(2, pubsub.WithBuffer(100, pubsub.DropOldest()))
+
+		for i := 0; i < 10; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		received := receiveAll(ch)
+		Expect(t, len(received)).To(BeBelow(4))
+		Expect(t, received[len(received)-1]).To(Equal(9))
+	})
+
+	o.Spec("it routes within a shard group", func(t TC) {
+		p := pubsub.New(pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+			return uint64(data.(int))
+		}))
+		a, _ := p.SubscribeChan(10, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("a"))
+		b, _ := p.SubscribeChan(10, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("b"))
+
+		for i := 0; i < 6; i++ {
+			p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, receiveAll(a)).To(Equal([]interface{}{0, 2, 4}))
+		Expect(t, receiveAll(b)).To(Equal([]interface{}{1, 3, 5}))
+	})
+
+	o.Spec("it yields the data of a sequence", func(t TC) {
+		seq := t.p.SubscribeSeq(context.Background(), 10)
+		go func() {
+			for i := 0; i < 5; i++ {
+				t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+			}
+		}()
+
+		var ds []interface{}
+		for d := range seq {
+			ds = append(ds, d)
+			if len(ds) == 3 {
+				break
+			}
+		}
+
+		Expect(t, ds).To(Equal([]interface{}{0, 1, 2}))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it ends the sequence once the context is done", func(t TC) {
+		ctx, cancel := context.WithCancel(context.Background())
+		seq := t.p.SubscribeSeq(ctx, 10)
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+
+		done := make(chan []interface{})
+		go func() {
+			var ds []interface{}
+			for d := range seq {
+				ds = append(ds, d)
+				cancel()
+			}
+			done <- ds
+		}()
+
+		Expect(t, done).To(Chain(Receive(ReceiveWait(time.Second)), Equal([]interface{}{1})))
+	})
+}
@@ -0,0 +1,44 @@
+package pubsub
+
+import "time"
+
+// Clock tells a PubSub the time and runs its timers. It is configured with
+// WithClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc invokes f on its own goroutine once d has passed. The
+	// returned Timer stops it.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by a Clock's AfterFunc. A *time.Timer
+// implements it.
+type Timer interface {
+	// Stop prevents the timer from firing. It reports false if the timer
+	// already fired or was stopped.
+	Stop() bool
+}
+
+// WithClock configures the Clock a PubSub uses to tell the time, e.g., to
+// age its history, and to remove subscriptions once their TTL has passed.
+// It defaults to the system clock.
+func WithClock(c Clock) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.clock = c
+	})
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+// Now implements Clock.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc implements Clock.
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
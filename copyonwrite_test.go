@@ -0,0 +1,102 @@
+package pubsub_test
+
+import (
+	"sync"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubCopyOnWrite(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(pubsub.WithCopyOnWrite()),
+		}
+	})
+
+	o.Spec("it publishes to the subscriptions", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+		t.p.Subscribe(f, pubsub.WithSegments(pubsub.Exact(1), pubsub.Wildcard()))
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		t.p.Publish("b", pubsub.LinearTreeTraverser([]uint64{1, 3}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"a"}))
+		Expect(t, other.data).To(Equal([]interface{}{"a", "b"}))
+	})
+
+	o.Spec("it cleans up the tree on unsubscribe", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+		unsubscribe := t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2, 3}))
+		unsubscribe()
+
+		Expect(t, t.p.Stats().Nodes).To(Equal(2))
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{1, 2, 3}))
+		Expect(t, t.subscription.data).To(HaveLen(1))
+	})
+
+	o.Spec("it does not change the tree a walk is reading", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		var nodes int
+		t.p.Walk(func([]uint64, pubsub.NodeInfo) bool {
+			nodes++
+			t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, uint64(nodes)}))
+			return true
+		})
+
+		Expect(t, nodes).To(Equal(2))
+		Expect(t, t.p.Stats().Nodes).To(Equal(4))
+	})
+
+	o.Spec("it can subscribe and unsubscribe from within a subscription", func(t TPS) {
+		var unsubscribe pubsub.Unsubscriber
+		unsubscribe = t.p.Subscribe(func(data interface{}) {
+			unsubscribe()
+			t.p.Subscribe(t.sub)
+		})
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser(nil))
+		t.p.Publish("b", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"b"}))
+	})
+
+	o.Spec("it publishes while subscribing", func(t TPS) {
+		var wg sync.WaitGroup
+		defer wg.Wait()
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					unsubscribe := t.p.Subscribe(func(interface{}) {}, pubsub.WithPath([]uint64{uint64(i), uint64(j % 3)}))
+					if j%2 == 0 {
+						unsubscribe()
+					}
+				}
+			}(i)
+		}
+
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{0}))
+		for i := 0; i < 100; i++ {
+			t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{0, uint64(i % 3)}))
+		}
+
+		Expect(t, t.subscription.data).To(HaveLen(100))
+	})
+}
@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+)
+
+// ErrorSubscription is a subscription that can fail. A returned error is
+// handed to the PubSub's DeadLetterHandler.
+type ErrorSubscription func(data interface{}) error
+
+// DeadLetter describes data that a subscription failed to handle.
+type DeadLetter struct {
+	// Data is the published data. For a batch subscription that was
+	// handed several items at once, it is the []T of items.
+	Data interface{}
+
+	// Path is the path the subscription subscribed with. Any PathSegment
+	// that is not Exact is reported as 0.
+	Path []uint64
+
+	// ShardID is the shard ID the subscription subscribed with.
+	ShardID string
+
+	// Err is the error returned by an ErrorSubscription or a *PanicError
+	// if the subscription panicked.
+	Err error
+}
+
+// DeadLetterHandler is invoked with each DeadLetter. It is invoked on the
+// goroutine that invoked the subscription.
+type DeadLetterHandler func(DeadLetter)
+
+// PanicError is the DeadLetter error for a subscription that panicked while
+// the PubSub was configured WithPanicRecovery.
+type PanicError struct {
+	// Value is the value that was recovered.
+	Value interface{}
+
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+// Error implements error.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("subscription panicked: %v", e.Value)
+}
+
+// WithDeadLetterHandler configures a PubSub to hand each error returned by
+// an ErrorSubscription, and each recovered panic, to the given handler.
+func WithDeadLetterHandler(h DeadLetterHandler) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.deadLetterHandler = h
+	})
+}
+
+// WithPanicRecovery configures a PubSub to recover a panic from each
+// subscription. The panic is handed to the DeadLetterHandler as a
+// *PanicError and the data is still delivered to the remaining
+// subscriptions.
+func WithPanicRecovery() PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.recoverPanics = true
+	})
+}
+
+// SubscribeError is like Subscribe, but for a subscription that returns an
+// error. Any error is handed to the DeadLetterHandler.
+func (s *Typed[T]) SubscribeError(sub func(data T) error, opts ...SubscribeOption) Unsubscriber {
+	return s.subscribe(func(_ context.Context, data T) error {
+		return sub(data)
+	}, opts)
+}
+
+// recoverPanic is deferred by a subscription's invocation when the PubSub
+// was configured WithPanicRecovery. batch is true if the data is a []T of
+// items handed to a batch subscription.
+func (s *subscription[T]) recoverPanic(d interface{}, batch bool) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if s.metrics != nil {
+		if s.beginReport() {
+			s.metrics.Panicked(s.info(batch))
+		}
+		s.endReport()
+	}
+
+	s.deadLetter(d, &PanicError{
+		Value: r,
+		Stack: debug.Stack(),
+	})
+}
+
+func (s *subscription[T]) deadLetter(d interface{}, err error) {
+	if s.deadLetterHandler == nil {
+		return
+	}
+
+	s.deadLetterHandler(DeadLetter{
+		Data:    d,
+		Path:    slices.Clone(s.path),
+		ShardID: s.shardID,
+		Err:     err,
+	})
+}
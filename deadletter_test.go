@@ -0,0 +1,123 @@
+package pubsub_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TD struct {
+	*testing.T
+	p           *pubsub.PubSub
+	deadLetters *spyDeadLetterHandler
+}
+
+func TestPubSubDeadLetters(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TD {
+		h := &spyDeadLetterHandler{}
+		return TD{
+			T:           t,
+			deadLetters: h,
+			p: pubsub.New(
+				pubsub.WithPanicRecovery(),
+				pubsub.WithDeadLetterHandler(h.handle),
+			),
+		}
+	})
+
+	o.Spec("it hands errors to the dead letter handler", func(t TD) {
+		var errSub pubsub.ErrorSubscription = func(interface{}) error {
+			return errors.New("some-error")
+		}
+		t.p.SubscribeError(errSub,
+			pubsub.WithPath([]uint64{1}),
+			pubsub.WithShardID("some-shard"),
+		)
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.deadLetters.letters).To(HaveLen(1))
+		l := t.deadLetters.letters[0]
+		Expect(t, l.Data).To(Equal("data"))
+		Expect(t, l.Path).To(Equal([]uint64{1}))
+		Expect(t, l.ShardID).To(Equal("some-shard"))
+		Expect(t, l.Err.Error()).To(Equal("some-error"))
+	})
+
+	o.Spec("it hands each dead letter its own path", func(t TD) {
+		t.p.SubscribeError(func(interface{}) error {
+			return errors.New("some-error")
+		}, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.deadLetters.letters[0].Path[0] = 9
+		t.p.Publish("b", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.deadLetters.letters).To(HaveLen(2))
+		Expect(t, t.deadLetters.letters[1].Path).To(Equal([]uint64{1}))
+	})
+
+	o.Spec("it does not hand successes to the dead letter handler", func(t TD) {
+		t.p.SubscribeError(func(interface{}) error {
+			return nil
+		})
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.deadLetters.letters).To(HaveLen(0))
+	})
+
+	o.Spec("it recovers panics and keeps delivering", func(t TD) {
+		sub, f := newSpySubscrption()
+		t.p.Subscribe(func(interface{}) {
+			panic("some-panic")
+		})
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, sub.data).To(HaveLen(1))
+		Expect(t, t.deadLetters.letters).To(HaveLen(1))
+
+		var pErr *pubsub.PanicError
+		Expect(t, errors.As(t.deadLetters.letters[0].Err, &pErr)).To(BeTrue())
+		Expect(t, pErr.Value).To(Equal("some-panic"))
+		Expect(t, pErr.Stack).To(Not(HaveLen(0)))
+	})
+
+	o.Spec("it does not recover panics by default", func(t TD) {
+		p := pubsub.New()
+		p.Subscribe(func(interface{}) {
+			panic("some-panic")
+		}, pubsub.WithPath([]uint64{2}))
+
+		Expect(t, func() {
+			p.Publish("data", pubsub.LinearTreeTraverser([]uint64{2}))
+		}).To(Panic())
+
+		// The PubSub is still usable after the panic.
+		sub, f := newSpySubscrption()
+		p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+		p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+		Expect(t, sub.data).To(HaveLen(1))
+	})
+}
+
+type spyDeadLetterHandler struct {
+	mu      sync.Mutex
+	letters []pubsub.DeadLetter
+}
+
+func (h *spyDeadLetterHandler) handle(l pubsub.DeadLetter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.letters = append(h.letters, l)
+}
@@ -0,0 +1,321 @@
+// Package debug serves the subscription tree of a PubSub over HTTP, in the
+// style of net/http/pprof. The handler is meant to be mounted under a path
+// that ends with a slash, e.g.:
+//
+//	mux.Handle("/debug/pubsub/", debug.Handler(ps, traverser))
+//
+// It serves the following paths beneath it:
+//
+//	/           an index of the other paths and a summary of the tree
+//	tree.json   the subscription tree as JSON (see Node)
+//	tree.dot    the subscription tree as a Graphviz DOT digraph
+//	explain     the pubsub.Trace of a sample payload that is POSTed to it
+//
+// For a pubsub.PubSub, explain needs to be told how to decode the sample
+// payload (see WithDecoder).
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/go-pubsub"
+)
+
+// maxPayloadSize is the largest sample payload explain reads.
+const maxPayloadSize = 1 << 20
+
+// Option configures the Handler.
+type Option interface {
+	configure(*config)
+}
+
+type configFunc func(*config)
+
+func (f configFunc) configure(c *config) {
+	f(c)
+}
+
+type config struct {
+	labels func(segments []pubsub.PathSegment) string
+	decode func(payload []byte) (interface{}, error)
+}
+
+// WithSegmentLabels configures the Handler to label each node of the tree.
+// The function is handed the segments from the root to the node and
+// returns a human-readable label for the last one, e.g., the name of the
+// field a TreeTraverser derives the path value from. An empty label is
+// omitted.
+func WithSegmentLabels(f func(segments []pubsub.PathSegment) string) Option {
+	return configFunc(func(c *config) {
+		c.labels = f
+	})
+}
+
+// WithDecoder configures how explain decodes the POSTed sample payload.
+// The returned value must be of the PubSub's type. It defaults to
+// unmarshalling the payload as JSON. There is no default if the PubSub's
+// type is an interface type, e.g., for a pubsub.PubSub, as the JSON would
+// not be decoded into the types its TreeTraverser expects. explain then
+// responds with 501 Not Implemented.
+func WithDecoder(f func(payload []byte) (interface{}, error)) Option {
+	return configFunc(func(c *config) {
+		c.decode = f
+	})
+}
+
+// Handler returns an http.Handler that serves the subscription tree of the
+// PubSub. explain traverses the tree with the TreeTraverser, which must be
+// the one the data is published with.
+func Handler[T any](s *pubsub.Typed[T], a pubsub.TypedTreeTraverser[T], opts ...Option) http.Handler {
+	c := config{
+		labels: func([]pubsub.PathSegment) string { return "" },
+	}
+	if reflect.TypeOf((*T)(nil)).Elem().Kind() != reflect.Interface {
+		c.decode = func(payload []byte) (interface{}, error) {
+			var d T
+			err := json.Unmarshal(payload, &d)
+			return d, err
+		}
+	}
+	for _, o := range opts {
+		o.configure(&c)
+	}
+
+	return &handler[T]{s: s, a: a, c: c}
+}
+
+type handler[T any] struct {
+	s *pubsub.Typed[T]
+	a pubsub.TypedTreeTraverser[T]
+	c config
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "tree.json":
+		h.serveJSON(w)
+	case "tree.dot":
+		h.serveDOT(w)
+	case "explain":
+		h.serveExplain(w, r)
+	default:
+		h.serveIndex(w)
+	}
+}
+
+// Node is a node of the subscription tree as rendered by tree.json.
+type Node struct {
+	// Path is the path from the root to the node. Any PathSegment that is
+	// not Exact is reported as 0.
+	Path []uint64 `json:"path"`
+
+	// Segment is the last PathSegment of the node's path, rendered with its
+	// String method. It is empty for the root.
+	Segment string `json:"segment,omitempty"`
+
+	// Label is the label of the segment (see WithSegmentLabels).
+	Label string `json:"label,omitempty"`
+
+	// Subscriptions is the number of subscriptions at the node.
+	Subscriptions int `json:"subscriptions"`
+
+	// ShardGroups is the number of subscriptions at the node per shard ID.
+	// Subscriptions without a shard ID are not included.
+	ShardGroups map[string]int `json:"shard_groups,omitempty"`
+
+	// RoutingNames are the deterministic routing names of the
+	// subscriptions at the node per shard ID.
+	RoutingNames map[string][]string `json:"routing_names,omitempty"`
+
+	// Children are the node's children, in the order pubsub.Walk visits
+	// them.
+	Children []*Node `json:"children,omitempty"`
+}
+
+// tree returns the root of the subscription tree.
+func (h *handler[T]) tree() *Node {
+	var stack []*Node
+
+	h.s.Walk(func(p []uint64, info pubsub.NodeInfo) bool {
+		n := &Node{
+			Path:          p,
+			Subscriptions: info.Subscriptions(),
+			RoutingNames:  info.RoutingNames,
+		}
+
+		if len(info.Segments) > 0 {
+			n.Segment = info.Segments[len(info.Segments)-1].String()
+			n.Label = h.c.labels(info.Segments)
+		}
+
+		for shardID, count := range info.SubscriptionCounts {
+			if shardID == "" {
+				continue
+			}
+			if n.ShardGroups == nil {
+				n.ShardGroups = make(map[string]int)
+			}
+			n.ShardGroups[shardID] = count
+		}
+
+		if len(n.RoutingNames) == 0 {
+			n.RoutingNames = nil
+		}
+
+		stack = stack[:info.Depth]
+		if info.Depth > 0 {
+			parent := stack[info.Depth-1]
+			parent.Children = append(parent.Children, n)
+		}
+		stack = append(stack, n)
+
+		return true
+	})
+
+	return stack[0]
+}
+
+func (h *handler[T]) serveJSON(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.tree())
+}
+
+func (h *handler[T]) serveDOT(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	writeDOT(w, h.tree())
+}
+
+// writeDOT renders the tree as a digraph. Each node is labeled with its
+// segment, its label and its subscription counts.
+func writeDOT(w io.Writer, root *Node) {
+	var b strings.Builder
+	b.WriteString("digraph pubsub {\n\tnode [shape=box];\n")
+
+	var id int
+	var write func(n *Node) int
+	write = func(n *Node) int {
+		nodeID := id
+		id++
+
+		lines := []string{"root"}
+		if n.Segment != "" {
+			lines[0] = n.Segment
+		}
+		if n.Label != "" {
+			lines[0] += " (" + n.Label + ")"
+		}
+		lines = append(lines, fmt.Sprintf("subscriptions: %d", n.Subscriptions))
+		for _, shardID := range sortedKeys(n.ShardGroups) {
+			lines = append(lines, fmt.Sprintf("shard %s: %d", shardID, n.ShardGroups[shardID]))
+		}
+
+		fmt.Fprintf(&b, "\tn%d [label=%s];\n", nodeID, dotQuote(strings.Join(lines, "\n")))
+
+		for _, child := range n.Children {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", nodeID, write(child))
+		}
+		return nodeID
+	}
+	write(root)
+
+	b.WriteString("}\n")
+	io.WriteString(w, b.String())
+}
+
+// dotQuote renders s as a quoted DOT string. Newlines are rendered as
+// centered line breaks.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveExplain decodes the POSTed sample payload and responds with the
+// pubsub.Trace of publishing it as JSON.
+func (h *handler[T]) serveExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST a sample payload to explain", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.c.decode == nil {
+		http.Error(w, "explain requires debug.WithDecoder for a PubSub of an interface type", http.StatusNotImplemented)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.c.decode(payload)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	d, ok := v.(T)
+	if !ok {
+		var zero T
+		http.Error(w, fmt.Sprintf("decoded payload is a %T, not a %T", v, zero), http.StatusBadRequest)
+		return
+	}
+
+	trace, err := h.explain(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trace)
+}
+
+// explain traces the data through the subscription tree. A panic of the
+// TreeTraverser, e.g., because the sample payload lacks a field it expects,
+// is returned as an error.
+func (h *handler[T]) explain(d T) (trace pubsub.Trace, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("the TreeTraverser panicked: %v", r)
+		}
+	}()
+
+	return h.s.Explain(d, h.a), nil
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<html>
+<head><title>pubsub</title></head>
+<body>
+<p>{{.Nodes}} nodes, {{.Subscriptions}} subscriptions, {{.ShardGroups}} shard groups, max depth {{.MaxDepth}}</p>
+<ul>
+<li><a href="tree.json">tree.json</a>: the subscription tree as JSON</li>
+<li><a href="tree.dot">tree.dot</a>: the subscription tree as a Graphviz DOT digraph</li>
+<li>explain: POST a sample payload to trace how it traverses the tree</li>
+</ul>
+</body>
+</html>
+`))
+
+func (h *handler[T]) serveIndex(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, h.s.Stats())
+}
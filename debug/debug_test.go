@@ -0,0 +1,198 @@
+package debug_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"code.cloudfoundry.org/go-pubsub/debug"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TD struct {
+	*testing.T
+	p      *pubsub.Typed[event]
+	server *httptest.Server
+}
+
+type event struct {
+	Kind   uint64 `json:"kind"`
+	Source uint64 `json:"source"`
+}
+
+func traverseEvent(e event) pubsub.TypedPaths[event] {
+	return pubsub.TypedPathsWithTraverser([]uint64{e.Kind}, func(e event) pubsub.TypedPaths[event] {
+		return pubsub.TypedFlatPaths[event]([]uint64{e.Source})
+	})
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TD {
+		p := pubsub.NewTyped[event]()
+		p.Subscribe(func(event) {}, pubsub.WithPath([]uint64{1}))
+		p.Subscribe(func(event) {}, pubsub.WithPath([]uint64{1, 2}), pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("a"))
+		p.Subscribe(func(event) {}, pubsub.WithPath([]uint64{1, 2}), pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("b"))
+		p.Subscribe(func(event) {}, pubsub.WithSegments(pubsub.Exact(1), pubsub.AnyOf(3, 4)))
+
+		labels := debug.WithSegmentLabels(func(segs []pubsub.PathSegment) string {
+			return []string{"kind", "source"}[len(segs)-1]
+		})
+
+		mux := http.NewServeMux()
+		mux.Handle("/debug/pubsub/", debug.Handler(p, traverseEvent, labels))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+
+		return TD{
+			T:      t,
+			p:      p,
+			server: server,
+		}
+	})
+
+	o.Spec("it serves an index", func(t TD) {
+		body, resp := t.get("/debug/pubsub/")
+
+		Expect(t, resp.Header.Get("Content-Type")).To(StartWith("text/html"))
+		Expect(t, body).To(ContainSubstring("4 nodes, 4 subscriptions, 1 shard groups"))
+		Expect(t, body).To(ContainSubstring(`href="tree.json"`))
+		Expect(t, body).To(ContainSubstring(`href="tree.dot"`))
+	})
+
+	o.Spec("it serves the tree as JSON", func(t TD) {
+		body, _ := t.get("/debug/pubsub/tree.json")
+
+		var root debug.Node
+		Expect(t, json.Unmarshal([]byte(body), &root)).To(Not(HaveOccurred()))
+
+		Expect(t, root.Subscriptions).To(Equal(0))
+		Expect(t, root.Children).To(HaveLen(1))
+
+		kind := root.Children[0]
+		Expect(t, kind.Path).To(Equal([]uint64{1}))
+		Expect(t, kind.Segment).To(Equal("1"))
+		Expect(t, kind.Label).To(Equal("kind"))
+		Expect(t, kind.Subscriptions).To(Equal(1))
+		Expect(t, kind.Children).To(HaveLen(2))
+
+		source := kind.Children[0]
+		Expect(t, source.Label).To(Equal("source"))
+		Expect(t, source.Subscriptions).To(Equal(2))
+		Expect(t, source.ShardGroups).To(Equal(map[string]int{"x": 2}))
+		Expect(t, source.RoutingNames).To(Equal(map[string][]string{"x": {"a", "b"}}))
+
+		Expect(t, kind.Children[1].Segment).To(Equal("{3,4}"))
+	})
+
+	o.Spec("it serves the tree as DOT", func(t TD) {
+		body, _ := t.get("/debug/pubsub/tree.dot")
+
+		Expect(t, body).To(StartWith("digraph pubsub {\n"))
+		Expect(t, body).To(ContainSubstring(`n0 [label="root\nsubscriptions: 0"];`))
+		Expect(t, body).To(ContainSubstring(`n1 [label="1 (kind)\nsubscriptions: 1"];`))
+		Expect(t, body).To(ContainSubstring(`n2 [label="2 (source)\nsubscriptions: 2\nshard x: 2"];`))
+		Expect(t, body).To(ContainSubstring("n0 -> n1;"))
+		Expect(t, body).To(ContainSubstring("n1 -> n2;"))
+	})
+
+	o.Spec("it explains a sample payload", func(t TD) {
+		resp, err := http.Post(t.server.URL+"/debug/pubsub/explain", "application/json", strings.NewReader(`{"kind":1,"source":3}`))
+		Expect(t, err).To(Not(HaveOccurred()))
+		defer resp.Body.Close()
+
+		var trace pubsub.Trace
+		Expect(t, json.NewDecoder(resp.Body).Decode(&trace)).To(Not(HaveOccurred()))
+		Expect(t, trace.Reached()).To(Equal(2))
+	})
+
+	o.Spec("it only explains POSTed payloads", func(t TD) {
+		_, resp := t.get("/debug/pubsub/explain")
+
+		Expect(t, resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	o.Spec("it rejects payloads that can not be decoded", func(t TD) {
+		resp, err := http.Post(t.server.URL+"/debug/pubsub/explain", "application/json", strings.NewReader(`{`))
+		Expect(t, err).To(Not(HaveOccurred()))
+		resp.Body.Close()
+
+		Expect(t, resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	o.Spec("it rejects decoded payloads of another type", func(t TD) {
+		h := debug.Handler(t.p, traverseEvent, debug.WithDecoder(func([]byte) (interface{}, error) {
+			return "data", nil
+		}))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/explain", strings.NewReader("data")))
+
+		Expect(t, rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(t, rec.Body.String()).To(ContainSubstring("decoded payload is a string"))
+	})
+
+	o.Spec("it requires a decoder for an interface type", func(t TD) {
+		p := pubsub.New()
+		h := debug.Handler(p, pubsub.LinearTreeTraverser(nil))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/explain", strings.NewReader(`{}`)))
+
+		Expect(t, rec.Code).To(Equal(http.StatusNotImplemented))
+	})
+
+	o.Spec("it explains with the decoder for an interface type", func(t TD) {
+		p := pubsub.New()
+		p.Subscribe(func(interface{}) {}, pubsub.WithPath([]uint64{1}))
+		h := debug.Handler(p, func(data interface{}) pubsub.Paths {
+			return pubsub.FlatPaths([]uint64{data.(event).Kind})
+		}, debug.WithDecoder(func(payload []byte) (interface{}, error) {
+			var e event
+			err := json.Unmarshal(payload, &e)
+			return e, err
+		}))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/explain", strings.NewReader(`{"kind":1}`)))
+
+		var trace pubsub.Trace
+		Expect(t, json.NewDecoder(rec.Body).Decode(&trace)).To(Not(HaveOccurred()))
+		Expect(t, trace.Reached()).To(Equal(1))
+	})
+
+	o.Spec("it responds with an error if the traverser panics", func(t TD) {
+		h := debug.Handler(t.p, func(event) pubsub.TypedPaths[event] {
+			panic("some-panic")
+		})
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/explain", strings.NewReader(`{}`)))
+
+		Expect(t, rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(t, rec.Body.String()).To(ContainSubstring("some-panic"))
+
+		// The read lock was released.
+		t.p.Subscribe(func(event) {})
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(5))
+	})
+}
+
+func (t TD) get(path string) (string, *http.Response) {
+	resp, err := http.Get(t.server.URL + path)
+	Expect(t, err).To(Not(HaveOccurred()))
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	Expect(t, err).To(Not(HaveOccurred()))
+
+	return string(body), resp
+}
@@ -0,0 +1,253 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RemovalReason tells why a subscription was removed automatically. It is
+// handed to the function configured WithRemovalHandler.
+type RemovalReason int
+
+const (
+	// RemovedByTTL means the subscription outlived its WithTTL.
+	RemovedByTTL RemovalReason = iota + 1
+
+	// RemovedByMaxDeliveries means the subscription was invoked as many
+	// times as WithMaxDeliveries allows.
+	RemovedByMaxDeliveries
+
+	// RemovedByContext means the context given to WithContext is done.
+	RemovedByContext
+)
+
+// String implements fmt.Stringer.
+func (r RemovalReason) String() string {
+	switch r {
+	case RemovedByTTL:
+		return "ttl"
+	case RemovedByMaxDeliveries:
+		return "max-deliveries"
+	case RemovedByContext:
+		return "context"
+	default:
+		return "unknown"
+	}
+}
+
+// WithTTL configures a subscription to be removed once the given duration
+// has passed since it subscribed, as told by the PubSub's clock (see
+// WithClock). It is removed by a timer, or when a Publish or PublishBatch
+// reaches it after it expired, whichever comes first. Explain, Match and
+// HasInterest skip it without removing it. Data that reaches an expired
+// member of a shard or consumer group is handed to the next member
+// instead, as if the expired member was paused (see
+// SubscriptionHandle.Pause).
+func WithTTL(ttl time.Duration) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.ttl = ttl
+	})
+}
+
+// WithMaxDeliveries configures a subscription to be removed once it was
+// invoked n times. A batch subscription counts each item, and is handed at
+// most the remaining number of items. Data that was buffered (see
+// WithBuffer) beyond the maximum is discarded. An n less than 1 is ignored.
+func WithMaxDeliveries(n int) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.maxDeliveries = n
+	})
+}
+
+// WithContext configures a subscription to be removed once the context is
+// done.
+func WithContext(ctx context.Context) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.ctx = ctx
+	})
+}
+
+// WithRemovalHandler configures a function to be invoked when the
+// subscription is removed because of WithTTL, WithMaxDeliveries or
+// WithContext. It is not invoked when the subscription unsubscribes. It is
+// invoked at most once, on the goroutine that removed the subscription,
+// which may be a publisher's.
+func WithRemovalHandler(f func(reason RemovalReason)) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.removalHandler = f
+	})
+}
+
+// expires reports whether the subscription is removed automatically.
+func (c subscribeConfig) expires() bool {
+	return c.ttl > 0 || c.maxDeliveries > 0 || c.ctx != nil
+}
+
+// expireWith configures the subscriber to unsubscribe with the handle once
+// it expires. It must be invoked before the subscription is added to the
+// subscription tree.
+func (s *subscriber[T]) expireWith(h *subscriptionHandle[T], c subscribeConfig, pc pubsubConfig) {
+	if c.ttl > 0 {
+		s.clock = pc.clock
+		s.deadline = pc.clock.Now().Add(c.ttl)
+	}
+
+	if c.maxDeliveries > 0 {
+		s.maxDeliveries = int64(c.maxDeliveries)
+	}
+
+	s.expire = func(r RemovalReason) {
+		if !h.unsubscribe() {
+			return
+		}
+
+		if c.removalHandler != nil {
+			c.removalHandler(r)
+		}
+	}
+}
+
+// watchExpiry starts the timer of a subscription configured WithTTL and
+// watches the context of one configured WithContext. The returned function
+// stops both.
+func (s *subscriber[T]) watchExpiry(c subscribeConfig) func() {
+	var stops []func()
+
+	if c.ttl > 0 {
+		t := &expiryTimer{clock: s.clock}
+		t.start(s.deadline.Sub(s.clock.Now()), func() (time.Duration, bool) {
+			if remaining := s.deadline.Sub(s.clock.Now()); remaining > 0 {
+				return remaining, false
+			}
+
+			s.expire(RemovedByTTL)
+			return 0, true
+		})
+		stops = append(stops, t.stop)
+	}
+
+	if c.ctx != nil {
+		stop := context.AfterFunc(c.ctx, func() {
+			s.expire(RemovedByContext)
+		})
+		stops = append(stops, func() { stop() })
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// expired reports whether the subscription outlived its TTL.
+func (s *subscriber[T]) expired() bool {
+	return !s.deadline.IsZero() && !s.clock.Now().Before(s.deadline)
+}
+
+// available reports whether the subscriber may be handed data. It is not
+// while it is paused, once it is removed and once it has expired.
+func (s *subscriber[T]) available() bool {
+	return !s.isPaused() && !s.isRemoved() && !s.expired()
+}
+
+// available reports whether the data may be handed to the subscription. An
+// expired subscription is handed to the visitor, so that a publish can
+// remove it once it has released the read lock.
+func available[T any](v visitor, sub *subscription[T]) bool {
+	if sub.available() {
+		return true
+	}
+
+	if sub.expired() {
+		v.expired(sub)
+	}
+	return false
+}
+
+// expiries collects the subscriptions that a publish found expired. It
+// implements the expired method of a visitor.
+type expiries[T any] struct {
+	expiredSubs []*subscription[T]
+}
+
+// expired implements visitor.
+func (e *expiries[T]) expired(sub interface{}) {
+	e.expiredSubs = append(e.expiredSubs, sub.(*subscription[T]))
+}
+
+// expireAll removes each collected subscription. It must not be invoked
+// while holding the read lock.
+func (e *expiries[T]) expireAll() {
+	for _, sub := range e.expiredSubs {
+		sub.expire(RemovedByTTL)
+	}
+}
+
+// take counts n invocations against the maximum number of deliveries. It
+// returns how many of them may be made and whether the maximum is reached
+// with them.
+func (s *subscriber[T]) take(n int) (int, bool) {
+	if s.maxDeliveries == 0 {
+		return n, false
+	}
+
+	over := atomic.AddInt64(&s.delivered, int64(n)) - s.maxDeliveries
+	switch {
+	case over >= int64(n):
+		return 0, false
+	case over >= 0:
+		return n - int(over), true
+	default:
+		return n, false
+	}
+}
+
+// expiryTimer invokes a check once a duration has passed on the PubSub's
+// Clock. The check returns when to invoke it again, unless it is done. A
+// Clock's timers may fire before its time tells the TTL has passed, so the
+// check is repeated until it does.
+type expiryTimer struct {
+	clock   Clock
+	mu      sync.Mutex
+	timer   Timer
+	stopped bool
+}
+
+func (t *expiryTimer) start(d time.Duration, check func() (time.Duration, bool)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var f func()
+	f = func() {
+		t.mu.Lock()
+		if t.stopped {
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		d, done := check()
+		if done {
+			return
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.stopped {
+			t.timer = t.clock.AfterFunc(d, f)
+		}
+	}
+
+	t.timer = t.clock.AfterFunc(d, f)
+}
+
+func (t *expiryTimer) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopped = true
+	t.timer.Stop()
+}
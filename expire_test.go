@@ -0,0 +1,171 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TE struct {
+	*testing.T
+	p            *pubsub.PubSub
+	clock        *fakeClock
+	subscription *spySubscription
+	sub          func(interface{})
+	reasons      chan pubsub.RemovalReason
+	onRemoved    pubsub.SubscribeOption
+}
+
+func TestPubSubExpiry(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TE {
+		s, f := newSpySubscrption()
+		clock := newFakeClock()
+		reasons := make(chan pubsub.RemovalReason, 10)
+
+		return TE{
+			T:            t,
+			p:            pubsub.New(pubsub.WithClock(clock)),
+			clock:        clock,
+			subscription: s,
+			sub:          f,
+			reasons:      reasons,
+			onRemoved: pubsub.WithRemovalHandler(func(r pubsub.RemovalReason) {
+				reasons <- r
+			}),
+		}
+	})
+
+	o.Spec("it removes the subscription once its TTL has passed", func(t TE) {
+		t.p.Subscribe(t.sub, pubsub.WithTTL(time.Minute), t.onRemoved)
+
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+		t.clock.advance(time.Minute)
+		t.p.Publish(2, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1}))
+		Expect(t, t.reasons).To(Chain(Receive(ReceiveWait(time.Second)), Equal(pubsub.RemovedByTTL)))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it only removes an expired subscription from a publish", func(t TE) {
+		t.p.Subscribe(t.sub, pubsub.WithTTL(time.Minute), t.onRemoved)
+		t.clock.advance(time.Minute)
+
+		trace := t.p.Explain(1, pubsub.LinearTreeTraverser(nil))
+		match := t.p.Match(1, pubsub.LinearTreeTraverser(nil))
+		interested := t.p.HasInterest(1, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, trace.Reached()).To(Equal(0))
+		Expect(t, match.Len()).To(Equal(0))
+		Expect(t, interested).To(BeFalse())
+		Expect(t, t.reasons).To(Not(Receive()))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(1))
+
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.reasons).To(Chain(Receive(), Equal(pubsub.RemovedByTTL)))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it removes the subscription with a timer of the clock", func(t TE) {
+		t.p.Subscribe(t.sub, pubsub.WithTTL(time.Minute), t.onRemoved)
+
+		t.clock.advance(time.Second)
+		Expect(t, t.reasons).To(Not(Receive(ReceiveWait(50 * time.Millisecond))))
+
+		t.clock.advance(time.Minute)
+		Expect(t, t.reasons).To(Chain(Receive(ReceiveWait(time.Second)), Equal(pubsub.RemovedByTTL)))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it removes the subscription with a timer of the system clock", func(t TE) {
+		p := pubsub.New()
+		p.Subscribe(t.sub, pubsub.WithTTL(10*time.Millisecond), t.onRemoved)
+
+		Expect(t, t.reasons).To(Chain(Receive(ReceiveWait(time.Second)), Equal(pubsub.RemovedByTTL)))
+		Expect(t, p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it hands an expired member's data to the next member", func(t TE) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithShardID("x"), pubsub.WithTTL(time.Minute))
+		t.p.Subscribe(f, pubsub.WithShardID("x"))
+
+		t.clock.advance(time.Minute)
+		for i := 0; i < 10; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+		Expect(t, other.data).To(HaveLen(10))
+	})
+
+	o.Spec("it removes the subscription after its maximum deliveries", func(t TE) {
+		t.p.Subscribe(t.sub, pubsub.WithMaxDeliveries(2), t.onRemoved)
+
+		for i := 0; i < 4; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{0, 1}))
+		Expect(t, t.reasons).To(Chain(Receive(), Equal(pubsub.RemovedByMaxDeliveries)))
+		Expect(t, t.reasons).To(Not(Receive()))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it counts each item of a batch", func(t TE) {
+		var batches [][]interface{}
+		t.p.SubscribeBatch(func(data []interface{}) {
+			batches = append(batches, data)
+		}, pubsub.WithMaxDeliveries(3))
+
+		t.p.PublishBatch([]interface{}{1, 2}, pubsub.LinearTreeTraverser(nil))
+		t.p.PublishBatch([]interface{}{3, 4}, pubsub.LinearTreeTraverser(nil))
+		t.p.PublishBatch([]interface{}{5}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, batches).To(Equal([][]interface{}{{1, 2}, {3}}))
+	})
+
+	o.Spec("it removes the subscription once the context is done", func(t TE) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.p.Subscribe(t.sub, pubsub.WithContext(ctx), t.onRemoved)
+
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+		cancel()
+
+		Expect(t, t.reasons).To(Chain(Receive(ReceiveWait(time.Second)), Equal(pubsub.RemovedByContext)))
+		t.p.Publish(2, pubsub.LinearTreeTraverser(nil))
+		Expect(t, t.subscription.received()).To(Equal([]interface{}{1}))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it removes the subscription if the context is already done", func(t TE) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		t.p.Subscribe(t.sub, pubsub.WithContext(ctx), t.onRemoved)
+
+		Expect(t, t.reasons).To(Chain(Receive(ReceiveWait(time.Second)), Equal(pubsub.RemovedByContext)))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+
+	o.Spec("it does not notify when the subscription unsubscribes", func(t TE) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		unsubscribe := t.p.Subscribe(t.sub, pubsub.WithContext(ctx), pubsub.WithTTL(time.Millisecond), t.onRemoved)
+
+		unsubscribe()
+		cancel()
+		t.clock.advance(time.Minute)
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.reasons).To(Not(Receive(ReceiveWait(50 * time.Millisecond))))
+	})
+}
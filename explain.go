@@ -0,0 +1,192 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// Trace describes how data traverses the subscription tree. It is returned
+// by Explain.
+type Trace struct {
+	// Steps are the paths the data traversed, in the order they were
+	// traversed. The first step is the root.
+	Steps []TraceStep
+}
+
+// TraceStep is a single path that data traversed, or the member selected
+// from a consumer group once the traversal was done.
+type TraceStep struct {
+	// Path is the path from the root to the node. The last element is the
+	// value the TreeTraverser's Paths returned for this step.
+	Path []uint64
+
+	// Pattern is the PathSegment (rendered with its String method) that
+	// matched the last path value. It is empty for an Exact segment.
+	Pattern string
+
+	// Missing is true if the path does not exist in the subscription tree.
+	// The data does not traverse any further down a missing path.
+	Missing bool
+
+	// Revisited is true if the node beneath a pattern was already visited.
+	// Its subscriptions are not reached again.
+	Revisited bool
+
+	// Subscriptions are the subscriptions at the node that the data
+	// reached. They are sorted by shard ID and then routing name.
+	Subscriptions []TraceSubscription
+
+	// ConsumerGroup is the name of the consumer group whose selected member
+	// is the step's only subscription. Path is then the path the member
+	// subscribed with. Any PathSegment that is not Exact is reported as 0.
+	ConsumerGroup string
+}
+
+// TraceSubscription is a subscription that data reached.
+type TraceSubscription struct {
+	// ShardID is the subscription's shard ID.
+	ShardID string
+
+	// RoutingName is the subscription's deterministic routing name.
+	RoutingName string
+
+	// ShardIndex is the index of the subscription that was selected within
+	// its shard group. ShardSize is the number of subscriptions in the shard
+	// group. Both are 0 for a subscription without a shard ID. For a
+	// consumer group, they describe the members the data reached instead.
+	ShardIndex int
+	ShardSize  int
+}
+
+// Reached returns the number of subscriptions the data reached.
+func (t Trace) Reached() int {
+	var total int
+	for _, s := range t.Steps {
+		total += len(s.Subscriptions)
+	}
+	return total
+}
+
+// String renders the trace with one line per step.
+func (t Trace) String() string {
+	var b strings.Builder
+	for _, s := range t.Steps {
+		fmt.Fprintf(&b, "%v", s.Path)
+		if s.ConsumerGroup != "" {
+			fmt.Fprintf(&b, " group(%s)", s.ConsumerGroup)
+		}
+		if s.Pattern != "" {
+			fmt.Fprintf(&b, " pattern(%s)", s.Pattern)
+		}
+		if s.Missing {
+			b.WriteString(" missing")
+		}
+		if s.Revisited {
+			b.WriteString(" revisited")
+		}
+
+		for _, ss := range s.Subscriptions {
+			if ss.ShardID == "" {
+				b.WriteString(" sub")
+				continue
+			}
+			fmt.Fprintf(&b, " shard(%s %d/%d %s)", ss.ShardID, ss.ShardIndex, ss.ShardSize, ss.RoutingName)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Explain traverses the subscription tree with the data the same way
+// Publish does, but it does not deliver the data to any subscription.
+// Instead it returns a Trace that describes each step. It is therefore
+// safe to use against a live PubSub. Shard groups that do not use
+// deterministic routing select a random subscription, and so the Trace
+// only shows one possible selection.
+func (s *Typed[T]) Explain(d T, a TypedTreeTraverser[T]) Trace {
+	var e explain
+
+	s.rlock()
+	defer s.runlock()
+	s.route(&e, d, a, s.root.Load(), []uint64{})
+
+	for _, step := range e.trace.Steps {
+		sort.Slice(step.Subscriptions, func(i, j int) bool {
+			a, b := step.Subscriptions[i], step.Subscriptions[j]
+			if a.ShardID != b.ShardID {
+				return a.ShardID < b.ShardID
+			}
+			return a.RoutingName < b.RoutingName
+		})
+	}
+
+	return e.trace
+}
+
+// explain is the visitor used by Explain.
+type explain struct {
+	seen
+	candidates
+	trace Trace
+}
+
+// selects implements visitor.
+func (e *explain) selects() bool {
+	return false
+}
+
+// stopped implements visitor.
+func (e *explain) stopped() bool {
+	return false
+}
+
+// visit implements visitor.
+func (e *explain) visit(path []uint64, _ int, pattern node.Pattern, n *node.Node) {
+	step := TraceStep{
+		Path:    append([]uint64(nil), path...),
+		Missing: n == nil,
+	}
+
+	if pattern != nil {
+		step.Pattern = pattern.String()
+	}
+
+	e.trace.Steps = append(e.trace.Steps, step)
+}
+
+// expired implements visitor. Explain leaves expired subscriptions to
+// Publish.
+func (e *explain) expired(interface{}) {}
+
+// firstVisit implements visitor. It records a revisited node in the trace.
+func (e *explain) firstVisit(n *node.Node) bool {
+	if e.seen.firstVisit(n) {
+		return true
+	}
+
+	e.trace.Steps[len(e.trace.Steps)-1].Revisited = true
+	return false
+}
+
+// reach implements visitor.
+func (e *explain) reach(x node.SubscriptionEnvelope, shardID string, idx, size int) {
+	step := &e.trace.Steps[len(e.trace.Steps)-1]
+	step.Subscriptions = append(step.Subscriptions, TraceSubscription{
+		ShardID:     shardID,
+		RoutingName: x.DeterministicRoutingName(),
+		ShardIndex:  idx,
+		ShardSize:   size,
+	})
+}
+
+// reachGroup implements visitor. It adds a step for the consumer group.
+func (e *explain) reachGroup(group string, path []uint64, x node.SubscriptionEnvelope, idx, size int) {
+	e.trace.Steps = append(e.trace.Steps, TraceStep{
+		Path:          append([]uint64(nil), path...),
+		ConsumerGroup: group,
+	})
+	e.reach(x, "", idx, size)
+}
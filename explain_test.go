@@ -0,0 +1,68 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubExplain(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p: pubsub.New(pubsub.WithDeterministicHashing(func(interface{}) uint64 {
+				return 1
+			})),
+		}
+	})
+
+	o.Spec("it traces the traversal without delivering", func(t TPS) {
+		t.p.Subscribe(t.sub)
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}), pubsub.WithShardID("a"), pubsub.WithDeterministicRouting("x"))
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}), pubsub.WithShardID("a"), pubsub.WithDeterministicRouting("y"))
+
+		trace := t.p.Explain("data", func(interface{}) pubsub.Paths {
+			return pubsub.PathAndTraversers([]pubsub.PathAndTraverser{
+				{Path: 1, Traverser: pubsub.LinearTreeTraverser([]uint64{2})},
+				{Path: 3, Traverser: pubsub.LinearTreeTraverser([]uint64{4})},
+			})
+		})
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+		Expect(t, trace.Reached()).To(Equal(3))
+		Expect(t, trace.Steps).To(Equal([]pubsub.TraceStep{
+			{
+				Path:          nil,
+				Subscriptions: []pubsub.TraceSubscription{{}},
+			},
+			{Path: []uint64{1}},
+			{
+				Path: []uint64{1, 2},
+				Subscriptions: []pubsub.TraceSubscription{
+					{},
+					{ShardID: "a", RoutingName: "y", ShardIndex: 1, ShardSize: 2},
+				},
+			},
+			{Path: []uint64{3}, Missing: true},
+		}))
+	})
+
+	o.Spec("it renders the trace", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		trace := t.p.Explain("data", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+
+		Expect(t, trace.String()).To(Equal("[]\n[1] sub\n[1 2] missing\n"))
+	})
+}
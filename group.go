@@ -0,0 +1,104 @@
+package pubsub
+
+import (
+	"sort"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// WithConsumerGroup configures a subscription to be a member of the consumer
+// group with the given name. Each publish is handed to exactly one member of
+// a consumer group that it reaches, regardless of the path each member
+// subscribed with. This is unlike a shard group, which only spans the
+// subscriptions at a single path.
+//
+// The members are selected from after the data has traversed the whole
+// subscription tree, and so they are invoked after every other
+// subscription. The member is selected with the ShardStrategy configured
+// for the group's name with WithShardStrategyFor or WithShardStrategy. If
+// there is not one, it is selected with deterministic hashing if any
+// reached member has a deterministic routing name, and randomly otherwise.
+func WithConsumerGroup(name string) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.group = name
+	})
+}
+
+// reach notifies the visitor of the subscription. A member of a consumer
+// group is instead added to the visitor's candidates (see reachGroups).
+func (s *Typed[T]) reach(v visitor, e node.SubscriptionEnvelope, shardID string, idx, size int) {
+	if group := e.Meta.(*subscription[T]).group; group != "" {
+		v.groupCandidates().add(group, e)
+		return
+	}
+
+	v.reach(e, shardID, idx, size)
+}
+
+// reachGroups selects one member of each consumer group the data reached.
+func (s *Typed[T]) reachGroups(v visitor, d T) {
+	c := v.groupCandidates()
+	for _, group := range c.order {
+		if v.stopped() {
+			return
+		}
+
+		ss := c.groups[group]
+		sort.SliceStable(ss, func(i, j int) bool {
+			return ss[i].DeterministicRoutingName() < ss[j].DeterministicRoutingName()
+		})
+
+		var isDeterministic bool
+		for _, e := range ss {
+			if e.DeterministicRoutingName() != "" {
+				isDeterministic = true
+				break
+			}
+		}
+
+		idx := s.determineIdx(v, d, group, ss, isDeterministic)
+		if idx < 0 || idx >= int64(len(ss)) {
+			continue
+		}
+
+		if idx = nextAvailable[T](v, ss, idx); idx < 0 {
+			continue
+		}
+
+		v.reachGroup(group, ss[idx].Meta.(*subscription[T]).path, ss[idx], int(idx), len(ss))
+	}
+}
+
+// candidates collects the members of each consumer group that the data
+// reached. It implements the groupCandidates method of a visitor. Its map is
+// only allocated when it is needed.
+type candidates struct {
+	groups map[string][]node.SubscriptionEnvelope
+	order  []string
+}
+
+// groupCandidates implements visitor.
+func (c *candidates) groupCandidates() *candidates {
+	return c
+}
+
+// add adds the member to the candidates of the group. A member that is
+// reached several times is only added once.
+func (c *candidates) add(group string, e node.SubscriptionEnvelope) {
+	if c.groups == nil {
+		c.groups = make(map[string][]node.SubscriptionEnvelope)
+	}
+
+	ss, ok := c.groups[group]
+	if !ok {
+		c.order = append(c.order, group)
+	}
+
+	for _, x := range ss {
+		if x.Meta == e.Meta {
+			return
+		}
+	}
+
+	c.groups[group] = append(ss, e)
+}
@@ -0,0 +1,155 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubConsumerGroups(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	// bothPaths reaches the nodes at [1] and [2].
+	bothPaths := func(interface{}) pubsub.Paths {
+		return pubsub.PathsWithTraverser([]uint64{1, 2}, pubsub.LinearTreeTraverser(nil))
+	}
+
+	o.Spec("it delivers to exactly one member across paths", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"))
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("workers"))
+
+		for i := 0; i < 100; i++ {
+			t.p.Publish(i, bothPaths)
+		}
+
+		Expect(t, len(t.subscription.data)+len(other.data)).To(Equal(100))
+		Expect(t, t.subscription.data).To(Not(HaveLen(0)))
+		Expect(t, other.data).To(Not(HaveLen(0)))
+	})
+
+	o.Spec("it only selects from the members the data reached", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"))
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("workers"))
+
+		for i := 0; i < 10; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser([]uint64{1}))
+		}
+
+		Expect(t, t.subscription.data).To(HaveLen(10))
+		Expect(t, other.data).To(HaveLen(0))
+	})
+
+	o.Spec("it delivers to each group", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("a"))
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("b"))
+
+		t.p.Publish("data", bothPaths)
+
+		Expect(t, t.subscription.data).To(HaveLen(1))
+		Expect(t, other.data).To(HaveLen(1))
+	})
+
+	o.Spec("it invokes members after the other subscriptions", func(t TPS) {
+		var order []string
+		t.p.Subscribe(func(interface{}) {
+			order = append(order, "member")
+		}, pubsub.WithConsumerGroup("workers"))
+		t.p.Subscribe(func(interface{}) {
+			order = append(order, "other")
+		}, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("data", bothPaths)
+
+		Expect(t, order).To(Equal([]string{"other", "member"}))
+	})
+
+	o.Spec("it selects with the group's strategy", func(t TPS) {
+		var sizes []int
+		p := pubsub.New(pubsub.WithShardStrategyFor("workers", pubsub.ShardStrategyFunc(func(_ interface{}, members []pubsub.ShardMember) int {
+			sizes = append(sizes, len(members))
+			return 1
+		})))
+		a, fa := newSpySubscrption()
+		b, fb := newSpySubscrption()
+		p.Subscribe(fa, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"), pubsub.WithDeterministicRouting("a"))
+		p.Subscribe(fb, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("workers"), pubsub.WithDeterministicRouting("b"))
+
+		// Reach [1] twice.
+		p.Publish("data", func(interface{}) pubsub.Paths {
+			return pubsub.PathsWithTraverser([]uint64{1, 2, 1}, pubsub.LinearTreeTraverser(nil))
+		})
+
+		Expect(t, sizes).To(Equal([]int{2}))
+		Expect(t, a.data).To(HaveLen(0))
+		Expect(t, b.data).To(HaveLen(1))
+	})
+
+	o.Spec("it records the selections of the group's strategy", func(t TPS) {
+		p := pubsub.New(pubsub.WithShardStrategyFor("workers", pubsub.RoundRobin()))
+		a, fa := newSpySubscrption()
+		b, fb := newSpySubscrption()
+		p.Subscribe(fa, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"), pubsub.WithDeterministicRouting("a"))
+		p.Subscribe(fb, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("workers"), pubsub.WithDeterministicRouting("b"))
+
+		for i := 0; i < 4; i++ {
+			p.Publish(i, bothPaths)
+		}
+
+		Expect(t, a.data).To(Equal([]interface{}{0, 2}))
+		Expect(t, b.data).To(Equal([]interface{}{1, 3}))
+	})
+
+	o.Spec("it selects deterministically with routing names", func(t TPS) {
+		p := pubsub.New(pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+			return uint64(data.(int))
+		}))
+		a, fa := newSpySubscrption()
+		b, fb := newSpySubscrption()
+		p.Subscribe(fb, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("workers"), pubsub.WithDeterministicRouting("b"))
+		p.Subscribe(fa, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"), pubsub.WithDeterministicRouting("a"))
+
+		p.Publish(0, bothPaths)
+		p.Publish(1, bothPaths)
+		p.Publish(2, bothPaths)
+
+		Expect(t, a.data).To(Equal([]interface{}{0, 2}))
+		Expect(t, b.data).To(Equal([]interface{}{1}))
+	})
+
+	o.Spec("it delivers each item of a batch to one member", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"))
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("workers"))
+
+		t.p.PublishBatch([]interface{}{1, 2, 3}, bothPaths)
+
+		Expect(t, len(t.subscription.data)+len(other.data)).To(Equal(3))
+	})
+
+	o.Spec("it explains the selected member", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithConsumerGroup("workers"))
+
+		trace := t.p.Explain("data", bothPaths)
+
+		Expect(t, trace.Reached()).To(Equal(1))
+		Expect(t, trace.String()).To(Equal("[]\n[1]\n[2] missing\n[1] group(workers) sub\n"))
+	})
+}
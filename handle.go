@@ -0,0 +1,269 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// SubscriptionHandle is returned by SubscribeHandle. It describes a
+// subscription and is used to pause, move or remove it. It is safe to use
+// from several goroutines and from within a subscription.
+type SubscriptionHandle struct {
+	id uint64
+	h  handle
+}
+
+// handle is implemented by each Typed's subscriptionHandle.
+type handle interface {
+	config() subscribeConfig
+	setPaused(paused bool)
+	paused() bool
+	update(opts []SubscribeOption) bool
+	unsubscribe() bool
+}
+
+// SubscribeHandle is like Subscribe, but it returns a SubscriptionHandle
+// instead of an Unsubscriber.
+func (s *Typed[T]) SubscribeHandle(sub func(data T), opts ...SubscribeOption) *SubscriptionHandle {
+	c := newSubscribeConfig(opts)
+	return s.add(newSubscription(func(_ context.Context, data T) error {
+		sub(data)
+		return nil
+	}, nil, c, s.pubsubConfig), c)
+}
+
+// ID returns the ID of the subscription. IDs are assigned in the order
+// the subscriptions subscribed, starting at 1, and are unique per PubSub.
+// The ID does not change when the subscription is updated.
+func (h *SubscriptionHandle) ID() uint64 {
+	return h.id
+}
+
+// Path returns the path the subscription resides at. Segments that are not
+// Exact are returned as 0 (see Segments).
+func (h *SubscriptionHandle) Path() []uint64 {
+	return segmentValues(h.h.config().segments)
+}
+
+// Segments returns the segments of the path the subscription resides at.
+func (h *SubscriptionHandle) Segments() []PathSegment {
+	return append([]PathSegment(nil), h.h.config().segments...)
+}
+
+// ShardID returns the shard ID of the subscription.
+func (h *SubscriptionHandle) ShardID() string {
+	return h.h.config().shardID
+}
+
+// RoutingName returns the deterministic routing name of the subscription.
+func (h *SubscriptionHandle) RoutingName() string {
+	return h.h.config().deterministicRoutingName
+}
+
+// ConsumerGroup returns the consumer group of the subscription.
+func (h *SubscriptionHandle) ConsumerGroup() string {
+	return h.h.config().group
+}
+
+// Pause stops the subscription from being handed any data until Resume is
+// invoked. Data published in the meantime is not handed over later. A
+// paused subscription keeps its place in its shard or consumer group:
+// data that would have been handed to it is handed to the next member of
+// the group that is not paused instead, while the data handed to every
+// other member is unaffected. Data that was already buffered (see
+// WithBuffer) is still handed over.
+func (h *SubscriptionHandle) Pause() {
+	h.h.setPaused(true)
+}
+
+// Resume undoes Pause.
+func (h *SubscriptionHandle) Resume() {
+	h.h.setPaused(false)
+}
+
+// Paused reports whether the subscription is paused.
+func (h *SubscriptionHandle) Paused() bool {
+	return h.h.paused()
+}
+
+// Update moves the subscription as if it had subscribed with the options
+// it was given and then the given ones. The options that place the
+// subscription take effect: WithPath, WithSegments, WithShardID,
+// WithDeterministicRouting, WithConsumerGroup, WithRoutingWeight,
+// WithShardKey and WithShardSeed. Any other option is ignored.
+//
+// The move is atomic: each publish reaches the subscription either where it
+// was or where it is moved to, never both or neither. The subscription
+// keeps its ID, buffer and callback, and is not handed retained values or
+// the history again. The move is done by the time Update returns, and it
+// reports whether the subscription was still subscribed.
+func (h *SubscriptionHandle) Update(opts ...SubscribeOption) bool {
+	return h.h.update(opts)
+}
+
+// Unsubscribe removes the subscription from the PubSub. It reports whether
+// this call removed it, i.e., it returns false if the subscription was
+// already removed. It is safe to invoke several times.
+func (h *SubscriptionHandle) Unsubscribe() bool {
+	return h.h.unsubscribe()
+}
+
+// unsubscriber returns an Unsubscriber that invokes Unsubscribe.
+func (h *SubscriptionHandle) unsubscriber() Unsubscriber {
+	return func() {
+		h.Unsubscribe()
+	}
+}
+
+// subscriptionHandle implements handle. The mutations of the subscription
+// tree are applied in order, but possibly after the method that made them
+// returned (see mutate). Each mutation therefore works with the state it
+// finds once it is applied. mu is never held while waiting for the write
+// lock.
+type subscriptionHandle[T any] struct {
+	s   *Typed[T]
+	sub *subscriber[T]
+
+	mu         sync.Mutex
+	c          subscribeConfig
+	rec        *subscription[T]
+	nodeID     int64
+	stopExpiry func()
+}
+
+// config implements handle.
+func (h *subscriptionHandle[T]) config() subscribeConfig {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.c
+}
+
+// setPaused implements handle.
+func (h *subscriptionHandle[T]) setPaused(paused bool) {
+	var v int32
+	if paused {
+		v = 1
+	}
+	atomic.StoreInt32(&h.sub.paused, v)
+}
+
+// paused implements handle.
+func (h *subscriptionHandle[T]) paused() bool {
+	return h.sub.isPaused()
+}
+
+// update implements handle.
+func (h *subscriptionHandle[T]) update(opts []SubscribeOption) bool {
+	if h.sub.isRemoved() {
+		return false
+	}
+
+	// moved returns the config the subscription is moved to.
+	moved := func() subscribeConfig {
+		c := h.c
+		for _, o := range opts {
+			o.configure(&c)
+		}
+		return c
+	}
+
+	paths := func() [][]PathSegment {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return [][]PathSegment{h.c.segments, moved().segments}
+	}
+
+	h.s.mutatePaths(paths, func(root *node.Node) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.sub.isRemoved() {
+			return
+		}
+
+		c := moved()
+		rec := h.sub.place(c, h.s.pubsubConfig)
+		if c.deterministicRoutingName == h.c.deterministicRoutingName {
+			rec.routingHash = h.rec.routingHash
+		}
+
+		h.s.cleanupSubscriptionTree(root, h.nodeID, h.c.segments)
+		h.nodeID = insert(root, rec, c)
+		h.c, h.rec = c, rec
+		h.sub.current.Store(rec)
+	}, nil)
+
+	return true
+}
+
+// unsubscribe implements handle.
+func (h *subscriptionHandle[T]) unsubscribe() bool {
+	if !h.sub.remove() {
+		return false
+	}
+
+	if h.sub.metrics != nil {
+		// Reports Unsubscribed unless another report is in progress.
+		h.sub.beginReport()
+		h.sub.endReport()
+	}
+
+	h.mu.Lock()
+	stop := h.stopExpiry
+	h.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+
+	paths := func() [][]PathSegment {
+		return [][]PathSegment{h.config().segments}
+	}
+
+	h.s.mutatePaths(paths, func(root *node.Node) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.s.cleanupSubscriptionTree(root, h.nodeID, h.c.segments)
+	}, nil)
+
+	return true
+}
+
+// insert adds the subscription record to the tree at the config's path. It
+// returns the ID of its envelope.
+func insert[T any](n *node.Node, ss *subscription[T], c subscribeConfig) int64 {
+	for _, seg := range c.segments {
+		n = addChild(n, seg)
+	}
+	return n.AddSubscriptionWithMeta(ss.envelopeFunc, ss, c.shardID, c.deterministicRoutingName)
+}
+
+// nextAvailable returns the index of the first member of a shard or
+// consumer group that is available, starting at idx and wrapping around.
+// It returns -1 if no member is available, e.g., each member is paused.
+func nextAvailable[T any](v visitor, ss []node.SubscriptionEnvelope, idx int64) int64 {
+	for i := 0; i < len(ss); i++ {
+		if available(v, ss[idx].Meta.(*subscription[T])) {
+			return idx
+		}
+		idx = (idx + 1) % int64(len(ss))
+	}
+	return -1
+}
+
+// watchExpiry starts watching for the subscription to expire. It must be
+// invoked once the subscription was added to the subscription tree.
+func (h *subscriptionHandle[T]) watchExpiry(c subscribeConfig) {
+	stop := h.sub.watchExpiry(c)
+
+	h.mu.Lock()
+	h.stopExpiry = stop
+	h.mu.Unlock()
+
+	// The subscription may have been removed before stopExpiry was set.
+	if h.sub.isRemoved() {
+		stop()
+	}
+}
@@ -0,0 +1,180 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubHandles(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	// valueHashing uses the published int as the hash.
+	valueHashing := pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+		return uint64(data.(int))
+	})
+
+	o.Spec("it assigns sequential IDs", func(t TPS) {
+		a := t.p.SubscribeHandle(t.sub)
+		b := t.p.SubscribeHandle(t.sub)
+		t.p.Subscribe(t.sub)
+		c := t.p.SubscribeHandle(t.sub)
+
+		Expect(t, a.ID()).To(Equal(uint64(1)))
+		Expect(t, b.ID()).To(Equal(uint64(2)))
+		Expect(t, c.ID()).To(Equal(uint64(4)))
+	})
+
+	o.Spec("it describes the subscription", func(t TPS) {
+		h := t.p.SubscribeHandle(t.sub,
+			pubsub.WithPath([]uint64{1, 2}),
+			pubsub.WithShardID("x"),
+			pubsub.WithDeterministicRouting("a"),
+		)
+
+		Expect(t, h.Path()).To(Equal([]uint64{1, 2}))
+		Expect(t, h.ShardID()).To(Equal("x"))
+		Expect(t, h.RoutingName()).To(Equal("a"))
+		Expect(t, h.ConsumerGroup()).To(Equal(""))
+	})
+
+	o.Spec("it does not deliver while paused", func(t TPS) {
+		h := t.p.SubscribeHandle(t.sub)
+
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+		h.Pause()
+		t.p.Publish(2, pubsub.LinearTreeTraverser(nil))
+		Expect(t, h.Paused()).To(BeTrue())
+		h.Resume()
+		t.p.Publish(3, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1, 3}))
+		Expect(t, h.Paused()).To(BeFalse())
+	})
+
+	o.Spec("it keeps a paused member's place in its shard group", func(t TPS) {
+		p := pubsub.New(valueHashing)
+		spies := make([]*spySubscription, 3)
+		handles := make([]*pubsub.SubscriptionHandle, 3)
+		for i, name := range []string{"a", "b", "c"} {
+			s, f := newSpySubscrption()
+			spies[i] = s
+			handles[i] = p.SubscribeHandle(f, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting(name))
+		}
+
+		handles[1].Pause()
+		for i := 0; i < 6; i++ {
+			p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, spies[0].data).To(Equal([]interface{}{0, 3}))
+		Expect(t, spies[1].data).To(HaveLen(0))
+		Expect(t, spies[2].data).To(Equal([]interface{}{1, 2, 4, 5}))
+
+		handles[1].Resume()
+		p.Publish(7, pubsub.LinearTreeTraverser(nil))
+		Expect(t, spies[1].data).To(Equal([]interface{}{7}))
+	})
+
+	o.Spec("it does not deliver when each member is paused", func(t TPS) {
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithConsumerGroup("workers"))
+		h.Pause()
+
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it moves the subscription to a new path", func(t TPS) {
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{1}))
+
+		Expect(t, h.Update(pubsub.WithPath([]uint64{2, 3}))).To(BeTrue())
+		t.p.Publish(1, pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.Publish(2, pubsub.LinearTreeTraverser([]uint64{2, 3}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{2}))
+		Expect(t, h.Path()).To(Equal([]uint64{2, 3}))
+		Expect(t, h.ID()).To(Equal(uint64(1)))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(1))
+	})
+
+	o.Spec("it moves the subscription to a new shard group", func(t TPS) {
+		other, f := newSpySubscrption()
+		t.p.Subscribe(f, pubsub.WithShardID("x"))
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithShardID("x"))
+
+		h.Update(pubsub.WithShardID("y"))
+		for i := 0; i < 10; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, t.subscription.data).To(HaveLen(10))
+		Expect(t, other.data).To(HaveLen(10))
+		Expect(t, h.ShardID()).To(Equal("y"))
+	})
+
+	o.Spec("it keeps the other options when updated", func(t TPS) {
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithShardID("x"))
+
+		h.Update(pubsub.WithDeterministicRouting("a"))
+
+		Expect(t, h.Path()).To(Equal([]uint64{1}))
+		Expect(t, h.ShardID()).To(Equal("x"))
+		Expect(t, h.RoutingName()).To(Equal("a"))
+	})
+
+	o.Spec("it applies an update made during a publish afterwards", func(t TPS) {
+		var h *pubsub.SubscriptionHandle
+		h = t.p.SubscribeHandle(func(data interface{}) {
+			t.sub(data)
+			h.Update(pubsub.WithPath([]uint64{2}))
+		}, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish(1, func(interface{}) pubsub.Paths {
+			return pubsub.PathsWithTraverser([]uint64{1, 2}, pubsub.LinearTreeTraverser(nil))
+		})
+		t.p.Publish(2, pubsub.LinearTreeTraverser([]uint64{2}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1, 2}))
+	})
+
+	o.Spec("it moves the subscription with copy-on-write", func(t TPS) {
+		p := pubsub.New(pubsub.WithCopyOnWrite())
+		h := p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{1, 2}))
+
+		h.Update(pubsub.WithPath([]uint64{1, 3}))
+		p.Publish(1, pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		p.Publish(2, pubsub.LinearTreeTraverser([]uint64{1, 3}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{2}))
+		Expect(t, p.Stats().Subscriptions).To(Equal(1))
+	})
+
+	o.Spec("it reports whether Unsubscribe removed the subscription", func(t TPS) {
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{1}))
+
+		Expect(t, h.Unsubscribe()).To(BeTrue())
+		Expect(t, h.Unsubscribe()).To(BeFalse())
+		Expect(t, h.Update(pubsub.WithPath([]uint64{2}))).To(BeFalse())
+
+		t.p.Publish(1, pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.Publish(2, pubsub.LinearTreeTraverser([]uint64{2}))
+		Expect(t, t.subscription.data).To(HaveLen(0))
+		Expect(t, t.p.Stats().Subscriptions).To(Equal(0))
+	})
+}
@@ -0,0 +1,128 @@
+package pubsub
+
+import (
+	"hash/fnv"
+	"math"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// WithConsistentHashing configures a PubSub to use rendezvous hashing for
+// shard groups that use deterministic routing. The hash of the data is
+// combined with each member's routing name, and the member with the highest
+// score is selected. When a member joins or leaves a shard group of N
+// members, only about 1/N of the hashes move to a different member. By
+// default, the hash modulo the number of members is used, which moves
+// almost every hash.
+//
+// Each member of the shard group should have a distinct routing name. The
+// cost of selecting a member grows with the size of the shard group.
+func WithConsistentHashing() PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.consistentHashing = true
+	})
+}
+
+// WithRoutingWeight configures the share of the hashes a subscription
+// receives within its shard group when the PubSub is configured
+// WithConsistentHashing. A member with a weight of 2 receives about twice as
+// many as a member with the default weight of 1. The weight must be
+// positive.
+func WithRoutingWeight(weight float64) SubscribeOption {
+	if weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		panic("Routing weight must be positive")
+	}
+
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.routingWeight = weight
+	})
+}
+
+// WithShardKey configures the function that hashes published data for the
+// subscription's shard group. It replaces the function given to
+// WithDeterministicHashing for that shard group only, and so different
+// shard groups can shard on different fields. Like WithDeterministicHashing,
+// it is only used by shard groups with a deterministic routing name. Every
+// member of a shard group should subscribe with the same function; the one
+// of the first member in routing order is used. For a Typed, the data is
+// handed to the function as an interface{} holding a T.
+func WithShardKey(key func(data interface{}) uint64) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.shardKey = key
+	})
+}
+
+// WithShardSeed configures a seed that is mixed into the hash of published
+// data for the subscription's shard group. Shard groups that hash the same
+// data with different seeds route it independently of each other. Every
+// member of a shard group should subscribe with the same seed; the one of
+// the first member in routing order is used.
+func WithShardSeed(seed uint64) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.shardSeed = seed
+		c.hasShardSeed = true
+	})
+}
+
+// shardHash hashes the data for the shard group. The members' shard key and
+// seed are used if set, and the PubSub's deterministic hashing otherwise.
+func (s *Typed[T]) shardHash(d T, ss []node.SubscriptionEnvelope) uint64 {
+	first := ss[0].Meta.(*subscription[T])
+
+	var hash uint64
+	if first.shardKey != nil {
+		hash = first.shardKey(d)
+	} else {
+		hash = s.deterministicRoutingHasher(d)
+	}
+
+	if first.hasShardSeed {
+		hash = mix(hash ^ mix(first.shardSeed))
+	}
+	return hash
+}
+
+// rendezvousIdx returns the index of the member of the shard group with the
+// highest weighted score for the hash.
+func rendezvousIdx[T any](hash uint64, ss []node.SubscriptionEnvelope) int64 {
+	var (
+		idx  int64
+		best = math.Inf(-1)
+	)
+
+	for i, e := range ss {
+		sub := e.Meta.(*subscription[T])
+		if score := rendezvousScore(hash, sub.routingHash, sub.routingWeight); score > best {
+			idx, best = int64(i), score
+		}
+	}
+
+	return idx
+}
+
+// rendezvousScore computes the weighted score of a member. The combined
+// hash is converted into a uniform value u in (0, 1), and the score is
+// -weight/ln(u). Weighting this way gives each member a share of the hashes
+// that is proportional to its weight.
+func rendezvousScore(hash, member uint64, weight float64) float64 {
+	u := (float64(mix(hash^member)>>11) + 0.5) / (1 << 53)
+	return -weight / math.Log(u)
+}
+
+// mix is the finalizer of SplitMix64. It spreads similar inputs (e.g.,
+// small integers) across the whole range.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// routingHash hashes a deterministic routing name.
+func routingHash(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return mix(h.Sum64())
+}
@@ -0,0 +1,209 @@
+package pubsub_test
+
+import (
+	"fmt"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TH struct {
+	*testing.T
+	p *pubsub.PubSub
+
+	// routes maps each published key to the routing name of the
+	// subscription that received it.
+	routes map[int]string
+}
+
+func TestPubSubConsistentHashing(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TH {
+		return TH{
+			T: t,
+			p: pubsub.New(
+				pubsub.WithConsistentHashing(),
+				pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+					return uint64(data.(int))
+				}),
+			),
+			routes: make(map[int]string),
+		}
+	})
+
+	const keys = 10000
+
+	subscribe := func(t TH, name string, opts ...pubsub.SubscribeOption) pubsub.Unsubscriber {
+		opts = append(opts, pubsub.WithShardID("group"), pubsub.WithDeterministicRouting(name))
+		return t.p.Subscribe(func(data interface{}) {
+			t.routes[data.(int)] = name
+		}, opts...)
+	}
+
+	publish := func(t TH) map[int]string {
+		for k := 0; k < keys; k++ {
+			t.p.Publish(k, pubsub.LinearTreeTraverser(nil))
+		}
+
+		routes := make(map[int]string, len(t.routes))
+		for k, name := range t.routes {
+			routes[k] = name
+		}
+		return routes
+	}
+
+	o.Spec("it only moves keys to a joining member", func(t TH) {
+		for i := 0; i < 10; i++ {
+			subscribe(t, fmt.Sprintf("member-%d", i))
+		}
+		before := publish(t)
+
+		subscribe(t, "member-10")
+		after := publish(t)
+
+		var moved int
+		for k := range before {
+			if before[k] == after[k] {
+				continue
+			}
+			moved++
+			Expect(t, after[k]).To(Equal("member-10"))
+		}
+
+		// About 1/11 of the keys should move.
+		Expect(t, moved > keys/11/2).To(BeTrue())
+		Expect(t, moved < keys/11*2).To(BeTrue())
+	})
+
+	o.Spec("it only moves keys away from a leaving member", func(t TH) {
+		var unsubscribe pubsub.Unsubscriber
+		for i := 0; i < 10; i++ {
+			unsubscribe = subscribe(t, fmt.Sprintf("member-%d", i))
+		}
+		before := publish(t)
+
+		unsubscribe()
+		after := publish(t)
+
+		for k := range before {
+			if before[k] != "member-9" {
+				Expect(t, after[k]).To(Equal(before[k]))
+				continue
+			}
+			Expect(t, after[k]).To(Not(Equal("member-9")))
+		}
+	})
+
+	o.Spec("it routes a share of the keys proportional to the weight", func(t TH) {
+		subscribe(t, "a")
+		subscribe(t, "b")
+		subscribe(t, "heavy", pubsub.WithRoutingWeight(2))
+
+		counts := make(map[string]int)
+		for _, name := range publish(t) {
+			counts[name]++
+		}
+
+		// The heavy member should receive about half of the keys.
+		Expect(t, counts["heavy"] > keys*4/10).To(BeTrue())
+		Expect(t, counts["heavy"] < keys*6/10).To(BeTrue())
+		Expect(t, counts["a"] > keys*2/10).To(BeTrue())
+		Expect(t, counts["b"] > keys*2/10).To(BeTrue())
+	})
+
+	o.Spec("it routes each key to a single member", func(t TH) {
+		a, fa := newSpySubscrption()
+		b, fb := newSpySubscrption()
+		t.p.Subscribe(fa, pubsub.WithShardID("group"), pubsub.WithDeterministicRouting("a"))
+		t.p.Subscribe(fb, pubsub.WithShardID("group"), pubsub.WithDeterministicRouting("b"))
+
+		for i := 0; i < 10; i++ {
+			t.p.Publish(7, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, len(a.data)+len(b.data)).To(Equal(10))
+		Expect(t, len(a.data) == 0 || len(b.data) == 0).To(BeTrue())
+	})
+
+	o.Spec("it panics for a weight that is not positive", func(t TH) {
+		Expect(t, func() { pubsub.WithRoutingWeight(0) }).To(Panic())
+		Expect(t, func() { pubsub.WithRoutingWeight(-1) }).To(Panic())
+	})
+}
+
+func TestPubSubShardKeys(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TH {
+		return TH{
+			T: t,
+			p: pubsub.New(pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+				return uint64(data.([2]int)[0])
+			})),
+			routes: make(map[int]string),
+		}
+	})
+
+	// subscribe adds the members "0" and "1" to the shard group and records
+	// which member each data point was routed to.
+	subscribe := func(t TH, shardID string, opts ...pubsub.SubscribeOption) map[[2]int]string {
+		routes := make(map[[2]int]string)
+		for _, name := range []string{"0", "1"} {
+			t.p.Subscribe(func(data interface{}) {
+				routes[data.([2]int)] = name
+			}, append(opts, pubsub.WithShardID(shardID), pubsub.WithDeterministicRouting(name))...)
+		}
+		return routes
+	}
+
+	publish := func(t TH) {
+		for i := 0; i < 100; i++ {
+			t.p.Publish([2]int{i, i + 1}, pubsub.LinearTreeTraverser(nil))
+		}
+	}
+
+	// differences counts the data points routed to different members.
+	differences := func(a, b map[[2]int]string) int {
+		var n int
+		for k := range a {
+			if a[k] != b[k] {
+				n++
+			}
+		}
+		return n
+	}
+
+	o.Spec("it shards each group on its own key", func(t TH) {
+		first := subscribe(t, "first")
+		second := subscribe(t, "second", pubsub.WithShardKey(func(data interface{}) uint64 {
+			return uint64(data.([2]int)[1])
+		}))
+
+		publish(t)
+
+		Expect(t, first[[2]int{2, 3}]).To(Equal("0"))
+		Expect(t, second[[2]int{2, 3}]).To(Equal("1"))
+		Expect(t, differences(first, second)).To(Equal(100))
+	})
+
+	o.Spec("it routes groups with different seeds independently", func(t TH) {
+		first := subscribe(t, "first")
+		second := subscribe(t, "second")
+		third := subscribe(t, "third", pubsub.WithShardSeed(1))
+		fourth := subscribe(t, "fourth", pubsub.WithShardSeed(2))
+		fifth := subscribe(t, "fifth", pubsub.WithShardSeed(2))
+
+		publish(t)
+
+		Expect(t, differences(first, second)).To(Equal(0))
+		Expect(t, differences(first, third) > 0).To(BeTrue())
+		Expect(t, differences(third, fourth) > 0).To(BeTrue())
+		Expect(t, differences(fourth, fifth)).To(Equal(0))
+	})
+}
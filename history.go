@@ -0,0 +1,245 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithHistory configures a PubSub to keep a history of the data it
+// publishes, along with the leaves of the TreeTraverser (see
+// PublishRetained). At most limit data points that are at most maxAge old
+// are kept. A limit or maxAge of 0 does not bound the history that way. If
+// both are 0, there is no history, which is the default. The history is
+// replayed to subscriptions configured WithReplay or WithReplayLast.
+func WithHistory(limit int, maxAge time.Duration) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.historyLimit = limit
+		s.historyAge = maxAge
+	})
+}
+
+// WithReplay configures a subscription to first be handed the data in the
+// PubSub's history that was published at or after the given time and that
+// its path leads to. Data published after that is handed over as usual.
+// Each data point is handed over exactly once: there are no gaps or
+// duplicates between the history and the live data. Live data that is
+// published while the history is replayed is held back until the replay
+// is done.
+//
+// The history is replayed to the subscription regardless of its shard or
+// consumer group. Retained values are not handed to a subscription that
+// replays the history. Without WithHistory, it does nothing.
+func WithReplay(since time.Time) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.replay = true
+		c.replaySince = since
+	})
+}
+
+// WithReplayLast is like WithReplay, but it replays the last n data points
+// in the history that the subscription's path leads to. It can be combined
+// with WithReplay to bound both.
+func WithReplayLast(n int) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.replay = true
+		c.replayLast = n
+	})
+}
+
+// history stores the data that was published. Each data point is given a
+// sequence number that is used to tell the history apart from live data.
+type history[T any] struct {
+	mu      sync.Mutex
+	entries []historyEntry[T]
+	seq     uint64
+}
+
+type historyEntry[T any] struct {
+	seq    uint64
+	time   time.Time
+	data   T
+	leaves [][]uint64
+}
+
+// historyEnabled reports whether the PubSub keeps a history.
+func (c pubsubConfig) historyEnabled() bool {
+	return c.historyLimit > 0 || c.historyAge > 0
+}
+
+// record adds the data to the history if there is one. It returns the
+// data's sequence number, which is 0 if there is no history. A publish must
+// record its data before it reads the subscription tree.
+func (s *Typed[T]) record(d T, a TypedTreeTraverser[T]) uint64 {
+	if !s.historyEnabled() {
+		return 0
+	}
+
+	var leaves [][]uint64
+	budget := maxRetainedPaths
+	traverseLeaves(d, a, nil, &budget, func(path []uint64) {
+		leaves = append(leaves, append([]uint64(nil), path...))
+	})
+
+	h := &s.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := s.clock.Now()
+	h.seq++
+	h.entries = append(h.entries, historyEntry[T]{
+		seq:    h.seq,
+		time:   now,
+		data:   d,
+		leaves: leaves,
+	})
+	h.trim(s.historyLimit, s.historyAge, now)
+
+	return h.seq
+}
+
+// trim discards the entries that are beyond the limit or too old. It must
+// be invoked while holding mu.
+func (h *history[T]) trim(limit int, maxAge time.Duration, now time.Time) {
+	var i int
+	for ; i < len(h.entries); i++ {
+		if limit > 0 && len(h.entries)-i > limit {
+			continue
+		}
+		if maxAge > 0 && now.Sub(h.entries[i].time) > maxAge {
+			continue
+		}
+		break
+	}
+
+	if i == 0 {
+		return
+	}
+
+	// Release the discarded data.
+	for j := 0; j < i; j++ {
+		h.entries[j] = historyEntry[T]{}
+	}
+	h.entries = h.entries[i:]
+}
+
+// lastSeq returns the sequence number of the most recently recorded data.
+func (h *history[T]) lastSeq() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.seq
+}
+
+// replayed returns the data up to the sequence number that the subscription
+// replays.
+func (s *Typed[T]) replayed(c subscribeConfig, upTo uint64) []T {
+	h := &s.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.trim(s.historyLimit, s.historyAge, s.clock.Now())
+
+	var ds []T
+	for _, e := range h.entries {
+		if e.seq > upTo {
+			break
+		}
+
+		if e.time.Before(c.replaySince) || !leadsToAny(c.segments, e.leaves) {
+			continue
+		}
+
+		ds = append(ds, e.data)
+	}
+
+	if c.replayLast > 0 && len(ds) > c.replayLast {
+		ds = ds[len(ds)-c.replayLast:]
+	}
+	return ds
+}
+
+func leadsToAny(segs []PathSegment, leaves [][]uint64) bool {
+	for _, l := range leaves {
+		if leadsTo(segs, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// replayGate holds back the live data of a subscription that replays the
+// history until the replay is done. Live data with a sequence number up to
+// the last replayed one is discarded, as it is part of the replay.
+type replayGate[T any] struct {
+	mu    sync.Mutex
+	after uint64
+	queue []gatedData[T]
+	open  bool
+}
+
+type gatedData[T any] struct {
+	ctx  context.Context
+	data T
+	seq  uint64
+}
+
+// hold reports whether the live data was held back or discarded.
+func (g *replayGate[T]) hold(ctx context.Context, d T, seq uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.open {
+		g.queue = append(g.queue, gatedData[T]{ctx: ctx, data: d, seq: seq})
+		return true
+	}
+
+	return seq != 0 && seq <= g.after
+}
+
+// replayVisible returns the function that mutate invokes once the
+// subscription is visible to publishes. It is nil unless the subscription
+// replays the history. Any data published after the function was invoked
+// reaches the subscription, so the history is replayed up to that point.
+func (s *Typed[T]) replayVisible(ss *subscription[T]) func() {
+	g := ss.gate
+	if g == nil {
+		return nil
+	}
+
+	return func() {
+		g.mu.Lock()
+		g.after = s.history.lastSeq()
+		g.mu.Unlock()
+	}
+}
+
+// replay hands the subscription the replayed history and then any live
+// data that was held back in the meantime.
+func (s *Typed[T]) replay(ss *subscription[T], c subscribeConfig) {
+	g := ss.gate
+
+	for _, d := range s.replayed(c, g.after) {
+		ss.deliver(context.Background(), d)
+	}
+
+	for {
+		g.mu.Lock()
+		queue := g.queue
+		g.queue = nil
+		if len(queue) == 0 {
+			g.open = true
+		}
+		g.mu.Unlock()
+
+		if len(queue) == 0 {
+			return
+		}
+
+		for _, x := range queue {
+			if x.seq != 0 && x.seq <= g.after {
+				continue
+			}
+			ss.deliver(x.ctx, x.data)
+		}
+	}
+}
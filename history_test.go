@@ -0,0 +1,201 @@
+package pubsub_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type THI struct {
+	*testing.T
+	p            *pubsub.PubSub
+	clock        *fakeClock
+	subscription *spySubscription
+	sub          func(interface{})
+}
+
+func TestPubSubHistory(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) THI {
+		s, f := newSpySubscrption()
+		clock := newFakeClock()
+
+		return THI{
+			T:            t,
+			p:            pubsub.New(pubsub.WithHistory(5, time.Minute), pubsub.WithClock(clock)),
+			clock:        clock,
+			subscription: s,
+			sub:          f,
+		}
+	})
+
+	o.Spec("it replays the last data the path leads to", func(t THI) {
+		for i := 0; i < 4; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser([]uint64{uint64(i % 2)}))
+		}
+
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithReplayLast(1))
+		t.p.Publish(5, pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{3, 5}))
+	})
+
+	o.Spec("it replays the data published since the given time", func(t THI) {
+		t.p.Publish(0, pubsub.LinearTreeTraverser(nil))
+		t.clock.advance(time.Second)
+		since := t.clock.Now()
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+		t.p.Publish(2, pubsub.LinearTreeTraverser(nil))
+
+		t.p.Subscribe(t.sub, pubsub.WithReplay(since))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1, 2}))
+	})
+
+	o.Spec("it bounds the history", func(t THI) {
+		for i := 0; i < 8; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+		t.clock.advance(time.Minute)
+		t.p.Publish(8, pubsub.LinearTreeTraverser(nil))
+
+		t.p.Subscribe(t.sub, pubsub.WithReplayLast(10))
+		Expect(t, t.subscription.data).To(Equal([]interface{}{4, 5, 6, 7, 8}))
+
+		other, f := newSpySubscrption()
+		t.clock.advance(time.Second)
+		t.p.Subscribe(f, pubsub.WithReplayLast(10))
+		Expect(t, other.data).To(Equal([]interface{}{8}))
+	})
+
+	o.Spec("it does not hand over retained values", func(t THI) {
+		t.p.PublishRetained(1, pubsub.LinearTreeTraverser(nil))
+
+		t.p.Subscribe(t.sub, pubsub.WithReplayLast(10))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1}))
+	})
+
+	o.Spec("it replays when subscribing from within a subscription", func(t THI) {
+		t.p.Publish(0, pubsub.LinearTreeTraverser(nil))
+
+		var once sync.Once
+		t.p.Subscribe(func(interface{}) {
+			once.Do(func() {
+				t.p.Subscribe(t.sub, pubsub.WithReplayLast(10))
+			})
+		})
+		t.p.Publish(1, pubsub.LinearTreeTraverser(nil))
+		t.p.Publish(2, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.received).To(ViaPolling(Equal([]interface{}{0, 1, 2})))
+	})
+
+	o.Spec("it does nothing without a history", func(t THI) {
+		p := pubsub.New()
+		p.Publish(0, pubsub.LinearTreeTraverser(nil))
+
+		p.Subscribe(t.sub, pubsub.WithReplayLast(10))
+		p.Publish(1, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{1}))
+	})
+
+	for _, cow := range []bool{false, true} {
+		o.Spec(fmt.Sprintf("it has no gaps or duplicates while publishing concurrently (copy on write: %v)", cow), func(t THI) {
+			opts := []pubsub.PubSubOption{pubsub.WithHistory(1000, 0)}
+			if cow {
+				opts = append(opts, pubsub.WithCopyOnWrite())
+			}
+			p := pubsub.New(opts...)
+
+			started := make(chan struct{})
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					if i == 100 {
+						close(started)
+					}
+					p.Publish(i, pubsub.LinearTreeTraverser(nil))
+				}
+			}()
+
+			<-started
+			p.Subscribe(t.sub, pubsub.WithReplayLast(1000))
+			wg.Wait()
+
+			var expected []interface{}
+			for i := 0; i < 1000; i++ {
+				expected = append(expected, i)
+			}
+			Expect(t, t.subscription.received).To(ViaPolling(Equal(expected)))
+		})
+	}
+}
+
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		t:      time.Unix(1000, 0),
+		timers: make(map[*fakeTimer]struct{}),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) pubsub.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.t.Add(d), f: f}
+	c.timers[t] = struct{}{}
+	return t
+}
+
+// advance moves the clock forward and fires the timers that are due, each
+// on its own goroutine.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+
+	for t := range c.timers {
+		if !t.at.After(c.t) {
+			delete(c.timers, t)
+			go t.f()
+		}
+	}
+}
+
+type fakeTimer struct {
+	c  *fakeClock
+	at time.Time
+	f  func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	_, ok := t.c.timers[t]
+	delete(t.c.timers, t)
+	return ok
+}
@@ -0,0 +1,161 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+)
+
+// PublishInterceptor wraps each publish. It is handed the context and the
+// data being published and must invoke next to continue the publish,
+// possibly with another context or data. Handing next data that is not of
+// the Typed's type panics. It is used with WithPublishInterceptor.
+type PublishInterceptor func(ctx context.Context, data interface{}, next func(ctx context.Context, data interface{}))
+
+// DeliveryInterceptor wraps each invocation of a subscription. It is handed
+// the context and the data being delivered along with a description of the
+// subscription, and must invoke next to invoke the subscription, possibly
+// with another context or data. The error it returns is handed to the
+// DeadLetterHandler, as is an error for data handed to next that is not of
+// the Typed's type. It is used with WithDeliveryInterceptor.
+type DeliveryInterceptor func(ctx context.Context, info DeliveryInfo, data interface{}, next func(ctx context.Context, data interface{}) error) error
+
+// DeliveryInfo describes the subscription a DeliveryInterceptor wraps.
+type DeliveryInfo struct {
+	// ID is the subscription's ID (see SubscriptionHandle.ID).
+	ID uint64
+
+	// Path is the path the subscription resides at. Any PathSegment that
+	// is not Exact is reported as 0.
+	Path []uint64
+
+	// ShardID is the subscription's shard ID.
+	ShardID string
+
+	// RoutingName is the subscription's deterministic routing name.
+	RoutingName string
+
+	// ConsumerGroup is the subscription's consumer group.
+	ConsumerGroup string
+
+	// Batch is true if the subscription is handed several items at once
+	// (see SubscribeBatch). The data is then the []T of items.
+	Batch bool
+}
+
+// WithPublishInterceptor configures a PubSub to wrap each Publish,
+// PublishContext, PublishRetained and PublishBatch with the interceptor.
+// The interceptor wraps both the traversal of the subscription tree and the
+// deliveries. PublishBatch invokes it once for the whole batch, with the
+// []T of items as the data, and next must be handed a []T as well. Several
+// interceptors are invoked in the order they were configured, with the
+// first being the outermost. Match and a MatchSet's Deliver do not invoke
+// the interceptors, as the subscriptions are already matched and data
+// changed by an interceptor could reach different ones.
+func WithPublishInterceptor(i PublishInterceptor) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.publishInterceptors = append(s.publishInterceptors, i)
+	})
+}
+
+// WithDeliveryInterceptor configures a PubSub to wrap each invocation of a
+// subscription with the interceptor. A buffered subscription (see
+// WithBuffer) is wrapped on its own goroutine. Several interceptors are
+// invoked in the order they were configured, with the first being the
+// outermost.
+func WithDeliveryInterceptor(i DeliveryInterceptor) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.deliveryInterceptors = append(s.deliveryInterceptors, i)
+	})
+}
+
+// intercept hands the data to next through the publish interceptors. The
+// data is a T, or a []T for PublishBatch.
+func (s *Typed[T]) intercept(ctx context.Context, data interface{}, next func(ctx context.Context, data interface{})) {
+	var call func(i int, ctx context.Context, data interface{})
+	call = func(i int, ctx context.Context, data interface{}) {
+		if i == len(s.publishInterceptors) {
+			next(ctx, data)
+			return
+		}
+
+		s.publishInterceptors[i](ctx, data, func(ctx context.Context, data interface{}) {
+			call(i+1, ctx, data)
+		})
+	}
+
+	call(0, ctx, data)
+}
+
+// intercepted returns the data that the publish interceptors passed on. It
+// panics if the data is not of type D.
+func intercepted[D any](data interface{}) D {
+	d, ok := asType[D](data)
+	if !ok {
+		panic(fmt.Sprintf("pubsub: a publish interceptor passed on a %T instead of a %T", data, d))
+	}
+	return d
+}
+
+// asType returns the data as a D. An untyped nil is only a D if D is an
+// interface type.
+func asType[D any](data interface{}) (D, bool) {
+	d, ok := data.(D)
+	if !ok && data == nil {
+		return d, interface{}(d) == nil
+	}
+	return d, ok
+}
+
+// errInterceptedType is handed to the DeadLetterHandler when a delivery
+// interceptor passes on data that is not of type D.
+func errInterceptedType[D any](data interface{}) error {
+	var d D
+	return fmt.Errorf("pubsub: a delivery interceptor passed on a %T instead of a %T", data, d)
+}
+
+// call invokes the subscriber through the delivery interceptors.
+func (s *subscription[T]) call(ctx context.Context, d T) error {
+	if len(s.interceptors) == 0 {
+		return s.f(ctx, d)
+	}
+
+	return s.intercept(ctx, d, false, func(ctx context.Context, data interface{}) error {
+		d, ok := asType[T](data)
+		if !ok {
+			return errInterceptedType[T](data)
+		}
+		return s.f(ctx, d)
+	})
+}
+
+// callBatch invokes the batch subscriber through the delivery interceptors.
+func (s *subscription[T]) callBatch(ctx context.Context, ds []T) error {
+	if len(s.interceptors) == 0 {
+		return s.batch(ctx, ds)
+	}
+
+	return s.intercept(ctx, ds, true, func(ctx context.Context, data interface{}) error {
+		ds, ok := asType[[]T](data)
+		if !ok {
+			return errInterceptedType[[]T](data)
+		}
+		return s.batch(ctx, ds)
+	})
+}
+
+func (s *subscription[T]) intercept(ctx context.Context, data interface{}, batch bool, f func(ctx context.Context, data interface{}) error) error {
+	info := s.info(batch)
+
+	var call func(i int, ctx context.Context, data interface{}) error
+	call = func(i int, ctx context.Context, data interface{}) error {
+		if i == len(s.interceptors) {
+			return f(ctx, data)
+		}
+
+		return s.interceptors[i](ctx, info, data, func(ctx context.Context, data interface{}) error {
+			return call(i+1, ctx, data)
+		})
+	}
+
+	return call(0, ctx, data)
+}
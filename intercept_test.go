@@ -0,0 +1,218 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubInterceptors(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	// redact replaces the published data.
+	redact := pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+		next(ctx, "redacted")
+	})
+
+	o.Spec("it wraps each publish", func(t TPS) {
+		var order []string
+		p := pubsub.New(
+			pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+				order = append(order, "a-before")
+				next(ctx, data)
+				order = append(order, "a-after")
+			}),
+			pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+				order = append(order, "b-before")
+				next(ctx, data)
+				order = append(order, "b-after")
+			}),
+		)
+		p.Subscribe(func(interface{}) {
+			order = append(order, "sub")
+		})
+
+		p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, order).To(Equal([]string{"a-before", "b-before", "sub", "b-after", "a-after"}))
+	})
+
+	o.Spec("it does not intercept a MatchSet", func(t TPS) {
+		p := pubsub.New(redact)
+		p.Subscribe(t.sub)
+
+		p.Match("data", pubsub.LinearTreeTraverser(nil)).Deliver()
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data"}))
+	})
+
+	o.Spec("it publishes the data handed to next", func(t TPS) {
+		p := pubsub.New(redact)
+		p.Subscribe(t.sub)
+
+		p.Publish("secret", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"redacted"}))
+	})
+
+	o.Spec("it wraps each batch as a whole", func(t TPS) {
+		var order []interface{}
+		p := pubsub.New(pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+			order = append(order, data)
+			next(context.WithValue(ctx, ctxKey{}, "tenant"), append(data.([]interface{}), "appended"))
+			order = append(order, "after")
+		}))
+		p.SubscribeContext(func(ctx context.Context, data interface{}) {
+			order = append(order, data, ctx.Value(ctxKey{}))
+		})
+
+		p.PublishBatch([]interface{}{"a", "b"}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, order).To(Equal([]interface{}{
+			[]interface{}{"a", "b"},
+			"a", "tenant",
+			"b", "tenant",
+			"appended", "tenant",
+			"after",
+		}))
+	})
+
+	o.Spec("it panics if next is handed data of another type", func(t TPS) {
+		p := pubsub.NewTyped[int](pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+			next(ctx, "not an int")
+		}))
+
+		Expect(t, func() {
+			p.Publish(1, pubsub.TypedLinearTreeTraverser[int](nil))
+		}).To(Panic())
+		Expect(t, func() {
+			p.PublishBatch([]int{1}, pubsub.TypedLinearTreeTraverser[int](nil))
+		}).To(Panic())
+	})
+
+	o.Spec("it publishes nil for a PubSub", func(t TPS) {
+		p := pubsub.New(pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+			next(ctx, data)
+		}))
+		p.Subscribe(t.sub)
+
+		p.Publish(nil, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{nil}))
+	})
+
+	o.Spec("it does not publish if next is not invoked", func(t TPS) {
+		p := pubsub.New(pubsub.WithPublishInterceptor(func(context.Context, interface{}, func(context.Context, interface{})) {}))
+		p.Subscribe(t.sub)
+
+		p.Publish("data", pubsub.LinearTreeTraverser(nil))
+		p.PublishBatch([]interface{}{"data"}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it publishes with the context handed to next", func(t TPS) {
+		p := pubsub.New(pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+			next(context.WithValue(ctx, ctxKey{}, "tenant"), data)
+		}))
+		var values []interface{}
+		p.SubscribeContext(func(ctx context.Context, data interface{}) {
+			values = append(values, ctx.Value(ctxKey{}))
+		})
+
+		p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, values).To(Equal([]interface{}{"tenant"}))
+	})
+
+	o.Spec("it describes the subscription to the delivery interceptor", func(t TPS) {
+		var infos []pubsub.DeliveryInfo
+		p := pubsub.New(pubsub.WithDeliveryInterceptor(func(ctx context.Context, info pubsub.DeliveryInfo, data interface{}, next func(context.Context, interface{}) error) error {
+			infos = append(infos, info)
+			return next(ctx, data)
+		}))
+		h := p.SubscribeHandle(t.sub,
+			pubsub.WithPath([]uint64{1}),
+			pubsub.WithShardID("x"),
+			pubsub.WithDeterministicRouting("a"),
+		)
+
+		p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data"}))
+		Expect(t, infos).To(Equal([]pubsub.DeliveryInfo{{
+			ID:          h.ID(),
+			Path:        []uint64{1},
+			ShardID:     "x",
+			RoutingName: "a",
+		}}))
+	})
+
+	o.Spec("it hands a batch to the delivery interceptor", func(t TPS) {
+		var data []interface{}
+		p := pubsub.New(pubsub.WithDeliveryInterceptor(func(ctx context.Context, info pubsub.DeliveryInfo, d interface{}, next func(context.Context, interface{}) error) error {
+			Expect(t, info.Batch).To(BeTrue())
+			data = append(data, d)
+			return next(ctx, d)
+		}))
+		p.SubscribeBatch(func([]interface{}) {})
+
+		p.PublishBatch([]interface{}{1, 2}, pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, data).To(Equal([]interface{}{[]interface{}{1, 2}}))
+	})
+
+	o.Spec("it hands the delivery interceptor's error to the DeadLetterHandler", func(t TPS) {
+		handler := &spyDeadLetterHandler{}
+		p := pubsub.New(
+			pubsub.WithDeadLetterHandler(handler.handle),
+			pubsub.WithDeliveryInterceptor(func(ctx context.Context, info pubsub.DeliveryInfo, data interface{}, next func(context.Context, interface{}) error) error {
+				return errors.New("some-error")
+			}),
+		)
+		p.Subscribe(t.sub)
+
+		p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+		Expect(t, handler.letters).To(HaveLen(1))
+		Expect(t, handler.letters[0].Err.Error()).To(Equal("some-error"))
+	})
+
+	o.Spec("it hands data of another type to the DeadLetterHandler", func(t TPS) {
+		handler := &spyDeadLetterHandler{}
+		p := pubsub.NewTyped[int](
+			pubsub.WithDeadLetterHandler(handler.handle),
+			pubsub.WithDeliveryInterceptor(func(ctx context.Context, info pubsub.DeliveryInfo, data interface{}, next func(context.Context, interface{}) error) error {
+				return next(ctx, "not an int")
+			}),
+		)
+		var data []int
+		p.Subscribe(func(d int) {
+			data = append(data, d)
+		})
+
+		p.Publish(1, pubsub.TypedLinearTreeTraverser[int](nil))
+
+		Expect(t, data).To(HaveLen(0))
+		Expect(t, handler.letters).To(HaveLen(1))
+		Expect(t, handler.letters[0].Data).To(Equal(1))
+	})
+}
@@ -0,0 +1,210 @@
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// HasSubscribers reports whether any subscription resides at the given path
+// or beneath it. A PathSegment that is not Exact resides at each path value
+// it matches. Subscriptions that reside above the path (e.g., at the root)
+// are not considered, even though data that traverses the path reaches
+// them (see HasInterest).
+func (s *Typed[T]) HasSubscribers(path []uint64) bool {
+	s.rlock()
+	defer s.runlock()
+
+	return hasSubscribers(s.root.Load(), path)
+}
+
+// HasInterest reports whether publishing the data would reach any
+// subscription, without delivering it. It stops traversing the subscription
+// tree as soon as one is reached. Paused subscriptions do not count (see
+// SubscriptionHandle.Pause), unless another member of their shard or
+// consumer group is not paused.
+func (s *Typed[T]) HasInterest(d T, a TypedTreeTraverser[T]) bool {
+	v := &interested{}
+
+	s.rlock()
+	defer s.runlock()
+
+	s.traverse(v, d, a, s.root.Load(), nil, 0, nil, s.atMostOnce)
+	return v.found || len(v.order) > 0
+}
+
+// OnInterestChange registers a function that is invoked with true when the
+// first subscription appears at or beneath the prefix and with false when
+// the last one disappears, as told by HasSubscribers. If there already are
+// subscriptions, it is invoked with true right away. The function is invoked
+// without holding the PubSub's lock, one notification at a time and in
+// order. It is safe to subscribe from within it. The returned Unsubscriber
+// stops the notifications.
+func (s *Typed[T]) OnInterestChange(prefix []uint64, f func(added bool)) Unsubscriber {
+	w := &interestWatcher{
+		prefix: append([]uint64(nil), prefix...),
+		f:      f,
+	}
+
+	s.lock()
+	i := &s.interest
+	i.mu.Lock()
+	w.has = hasSubscribers(s.root.Load(), w.prefix)
+	if w.has {
+		i.queue = append(i.queue, w.notification(true))
+	}
+	i.watchers = append(i.watchers, w)
+	atomic.StoreInt32(&i.len, int32(len(i.watchers)))
+	i.mu.Unlock()
+	s.unlock()
+
+	return func() {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		for j, x := range i.watchers {
+			if x == w {
+				i.watchers = append(i.watchers[:j], i.watchers[j+1:]...)
+				break
+			}
+		}
+		atomic.StoreInt32(&i.len, int32(len(i.watchers)))
+		w.stopped.Store(true)
+	}
+}
+
+// interest holds the functions registered with OnInterestChange and the
+// notifications that are yet to be delivered.
+type interest struct {
+	mu        sync.Mutex
+	watchers  []*interestWatcher
+	len       int32
+	queue     []func()
+	notifying bool
+}
+
+type interestWatcher struct {
+	prefix []uint64
+	f      func(added bool)
+	has    bool
+
+	stopped atomic.Bool
+}
+
+// notification returns a function that notifies the watcher unless it was
+// stopped in the meantime.
+func (w *interestWatcher) notification(added bool) func() {
+	return func() {
+		if !w.stopped.Load() {
+			w.f(added)
+		}
+	}
+}
+
+// checkInterest queues a notification for each watcher whose prefix gained
+// its first or lost its last subscription. It must be invoked while holding
+// the write lock once a change to the subscription tree is visible.
+func (s *Typed[T]) checkInterest(root *node.Node) {
+	i := &s.interest
+	if atomic.LoadInt32(&i.len) == 0 {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, w := range i.watchers {
+		if has := hasSubscribers(root, w.prefix); has != w.has {
+			w.has = has
+			i.queue = append(i.queue, w.notification(has))
+		}
+	}
+}
+
+// notifyInterest delivers the queued notifications. It must be invoked
+// without holding the write lock. If another goroutine is already
+// delivering them, it delivers the queued ones as well.
+func (s *Typed[T]) notifyInterest() {
+	i := &s.interest
+
+	i.mu.Lock()
+	if i.notifying || len(i.queue) == 0 {
+		i.mu.Unlock()
+		return
+	}
+	i.notifying = true
+
+	for len(i.queue) > 0 {
+		queue := i.queue
+		i.queue = nil
+		i.mu.Unlock()
+
+		for _, f := range queue {
+			f()
+		}
+
+		i.mu.Lock()
+	}
+
+	i.notifying = false
+	i.mu.Unlock()
+}
+
+// hasSubscribers reports whether any subscription resides at or beneath
+// the path. Empty nodes are removed from the tree, so any node that has a
+// child has a subscription beneath it.
+func hasSubscribers(n *node.Node, path []uint64) bool {
+	if n == nil {
+		return false
+	}
+
+	if len(path) == 0 {
+		return n.SubscriptionLen() > 0 || n.ChildLen() > 0
+	}
+
+	if hasSubscribers(n.FetchChild(path[0]), path[1:]) {
+		return true
+	}
+
+	var found bool
+	n.ForEachMatchingPatternChild(path[0], func(_ node.Pattern, child *node.Node) {
+		found = found || hasSubscribers(child, path[1:])
+	})
+	return found
+}
+
+// interested is the visitor used by HasInterest. It stops at the first
+// subscription it reaches.
+type interested struct {
+	seen
+	candidates
+
+	found bool
+}
+
+// selects implements visitor.
+func (v *interested) selects() bool {
+	return false
+}
+
+// stopped implements visitor.
+func (v *interested) stopped() bool {
+	return v.found || len(v.order) > 0
+}
+
+// visit implements visitor.
+func (v *interested) visit([]uint64, int, node.Pattern, *node.Node) {}
+
+// expired implements visitor.
+func (v *interested) expired(interface{}) {}
+
+// reach implements visitor.
+func (v *interested) reach(node.SubscriptionEnvelope, string, int, int) {
+	v.found = true
+}
+
+// reachGroup implements visitor.
+func (v *interested) reachGroup(string, []uint64, node.SubscriptionEnvelope, int, int) {
+	v.found = true
+}
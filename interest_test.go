@@ -0,0 +1,143 @@
+package pubsub_test
+
+import (
+	"sync"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubInterest(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	o.Spec("it reports subscribers at or beneath a path", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+
+		Expect(t, t.p.HasSubscribers(nil)).To(BeTrue())
+		Expect(t, t.p.HasSubscribers([]uint64{1})).To(BeTrue())
+		Expect(t, t.p.HasSubscribers([]uint64{1, 2})).To(BeTrue())
+		Expect(t, t.p.HasSubscribers([]uint64{1, 2, 3})).To(BeFalse())
+		Expect(t, t.p.HasSubscribers([]uint64{2})).To(BeFalse())
+	})
+
+	o.Spec("it matches pattern segments", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.Exact(1), pubsub.AnyOf(2, 3)))
+
+		Expect(t, t.p.HasSubscribers([]uint64{1, 3})).To(BeTrue())
+		Expect(t, t.p.HasSubscribers([]uint64{1, 4})).To(BeFalse())
+	})
+
+	o.Spec("it no longer reports removed subscribers", func(t TPS) {
+		unsubscribe := t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+		unsubscribe()
+
+		Expect(t, t.p.HasSubscribers([]uint64{1})).To(BeFalse())
+		Expect(t, t.p.HasSubscribers(nil)).To(BeFalse())
+	})
+
+	o.Spec("it reports whether data would reach a subscription", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+
+		Expect(t, t.p.HasInterest("data", pubsub.LinearTreeTraverser([]uint64{1, 2}))).To(BeTrue())
+		Expect(t, t.p.HasInterest("data", pubsub.LinearTreeTraverser([]uint64{1}))).To(BeFalse())
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it reports interest of shard and consumer groups", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithShardID("x"))
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{2}), pubsub.WithConsumerGroup("g"))
+
+		Expect(t, t.p.HasInterest("data", pubsub.LinearTreeTraverser([]uint64{1}))).To(BeTrue())
+		Expect(t, t.p.HasInterest("data", pubsub.LinearTreeTraverser([]uint64{2}))).To(BeTrue())
+
+		h.Pause()
+		Expect(t, t.p.HasInterest("data", pubsub.LinearTreeTraverser([]uint64{2}))).To(BeFalse())
+	})
+
+	o.Spec("it stops traversing at the first subscription", func(t TPS) {
+		t.p.Subscribe(t.sub)
+
+		var calls int
+		var a pubsub.TreeTraverser
+		a = func(interface{}) pubsub.Paths {
+			calls++
+			return pubsub.PathsWithTraverser([]uint64{1}, a)
+		}
+
+		Expect(t, t.p.HasInterest("data", a)).To(BeTrue())
+		Expect(t, calls).To(Equal(0))
+	})
+
+	o.Spec("it notifies when interest under a prefix changes", func(t TPS) {
+		var changes []bool
+		stop := t.p.OnInterestChange([]uint64{1}, func(added bool) {
+			changes = append(changes, added)
+		})
+
+		a := t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+		b := t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{2}))
+		a()
+		b()
+		Expect(t, changes).To(Equal([]bool{true, false}))
+
+		stop()
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+		Expect(t, changes).To(Equal([]bool{true, false}))
+	})
+
+	o.Spec("it notifies right away if there is already interest", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		var changes []bool
+		t.p.OnInterestChange([]uint64{1}, func(added bool) {
+			changes = append(changes, added)
+		})
+
+		Expect(t, changes).To(Equal([]bool{true}))
+	})
+
+	o.Spec("it notifies without holding the lock", func(t TPS) {
+		p := pubsub.New(pubsub.WithCopyOnWrite())
+		var once sync.Once
+		p.OnInterestChange(nil, func(added bool) {
+			once.Do(func() {
+				p.Subscribe(t.sub, pubsub.WithPath([]uint64{2}))
+			})
+		})
+
+		p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		Expect(t, p.Stats().Subscriptions).To(Equal(2))
+	})
+
+	o.Spec("it notifies for changes made during a publish", func(t TPS) {
+		var changes []bool
+		t.p.OnInterestChange([]uint64{1}, func(added bool) {
+			changes = append(changes, added)
+		})
+
+		var unsubscribe pubsub.Unsubscriber
+		unsubscribe = t.p.Subscribe(func(interface{}) {
+			unsubscribe()
+		}, pubsub.WithPath([]uint64{1}))
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, changes).To(Equal([]bool{true, false}))
+	})
+}
@@ -6,11 +6,25 @@ import (
 
 type Node struct {
 	children      map[uint64]*Node
+	patterns      map[string]patternChild
 	subscriptions map[string]subscriptionInfo
 	shards        map[int64]string
 	rand          func(int64) int64
 }
 
+// Pattern matches path values. A child stored under a Pattern is reached
+// by every path value the Pattern matches. Patterns with the same String
+// are considered equal.
+type Pattern interface {
+	String() string
+	Match(v uint64) bool
+}
+
+type patternChild struct {
+	pattern Pattern
+	node    *Node
+}
+
 type subscriptionInfo struct {
 	deterministicRoutingCount int
 	envelopes                 []SubscriptionEnvelope
@@ -18,10 +32,17 @@ type subscriptionInfo struct {
 
 type SubscriptionEnvelope struct {
 	Subscription func(interface{})
+	Meta         interface{}
 	id           int64
 	dName        string
 }
 
+// DeterministicRoutingName returns the deterministic routing name the
+// subscription was added with.
+func (e SubscriptionEnvelope) DeterministicRoutingName() string {
+	return e.dName
+}
+
 func New(int63n func(n int64) int64) *Node {
 	return &Node{
 		children:      make(map[uint64]*Node),
@@ -57,6 +78,16 @@ func (n *Node) FetchChild(key uint64) *Node {
 	return nil
 }
 
+// SetChild stores the given child under the key, replacing any existing
+// child.
+func (n *Node) SetChild(key uint64, child *Node) {
+	if n == nil {
+		return
+	}
+
+	n.children[key] = child
+}
+
 func (n *Node) DeleteChild(key uint64) {
 	if n == nil {
 		return
@@ -65,11 +96,166 @@ func (n *Node) DeleteChild(key uint64) {
 	delete(n.children, key)
 }
 
+// ChildLen returns the number of children, including pattern children.
 func (n *Node) ChildLen() int {
-	return len(n.children)
+	return len(n.children) + len(n.patterns)
+}
+
+// AddPatternChild returns the child stored under the given Pattern,
+// creating it if necessary.
+func (n *Node) AddPatternChild(p Pattern) *Node {
+	if n == nil {
+		return nil
+	}
+
+	key := p.String()
+	if pc, ok := n.patterns[key]; ok {
+		return pc.node
+	}
+
+	if n.patterns == nil {
+		n.patterns = make(map[string]patternChild)
+	}
+
+	child := New(n.rand)
+	n.patterns[key] = patternChild{pattern: p, node: child}
+	return child
+}
+
+// FetchPatternChild returns the child stored under the given Pattern or
+// nil if there is not one.
+func (n *Node) FetchPatternChild(p Pattern) *Node {
+	if n == nil {
+		return nil
+	}
+
+	return n.patterns[p.String()].node
+}
+
+// SetPatternChild stores the given child under the Pattern, replacing any
+// existing child.
+func (n *Node) SetPatternChild(p Pattern, child *Node) {
+	if n == nil {
+		return
+	}
+
+	if n.patterns == nil {
+		n.patterns = make(map[string]patternChild)
+	}
+
+	n.patterns[p.String()] = patternChild{pattern: p, node: child}
+}
+
+// DeletePatternChild removes the child stored under the given Pattern.
+func (n *Node) DeletePatternChild(p Pattern) {
+	if n == nil {
+		return
+	}
+
+	delete(n.patterns, p.String())
+}
+
+// PatternLen returns the number of pattern children.
+func (n *Node) PatternLen() int {
+	if n == nil {
+		return 0
+	}
+
+	return len(n.patterns)
+}
+
+// ForEachMatchingPatternChild invokes f with each pattern child whose
+// Pattern matches the given path value.
+func (n *Node) ForEachMatchingPatternChild(v uint64, f func(p Pattern, child *Node)) {
+	if n == nil {
+		return
+	}
+
+	for _, pc := range n.patterns {
+		if pc.pattern.Match(v) {
+			f(pc.pattern, pc.node)
+		}
+	}
+}
+
+// ForEachPatternChild invokes f with each pattern child in ascending order
+// of the Patterns' String.
+func (n *Node) ForEachPatternChild(f func(p Pattern, child *Node)) {
+	if n == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(n.patterns))
+	for k := range n.patterns {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pc := n.patterns[k]
+		f(pc.pattern, pc.node)
+	}
+}
+
+// ChildKeys returns the keys of the Node's children in ascending order.
+func (n *Node) ChildKeys() []uint64 {
+	if n == nil {
+		return nil
+	}
+
+	keys := make([]uint64, 0, len(n.children))
+	for k := range n.children {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return keys
+}
+
+// Clone returns a copy of the Node that can be changed without changing
+// the original. The children themselves are shared and are not copied.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+
+	c := &Node{
+		children:      make(map[uint64]*Node, len(n.children)),
+		subscriptions: make(map[string]subscriptionInfo, len(n.subscriptions)),
+		shards:        make(map[int64]string, len(n.shards)),
+		rand:          n.rand,
+	}
+
+	for k, child := range n.children {
+		c.children[k] = child
+	}
+
+	if len(n.patterns) > 0 {
+		c.patterns = make(map[string]patternChild, len(n.patterns))
+		for k, pc := range n.patterns {
+			c.patterns[k] = pc
+		}
+	}
+
+	for shardID, si := range n.subscriptions {
+		si.envelopes = append([]SubscriptionEnvelope(nil), si.envelopes...)
+		c.subscriptions[shardID] = si
+	}
+
+	for id, shardID := range n.shards {
+		c.shards[id] = shardID
+	}
+
+	return c
 }
 
 func (n *Node) AddSubscription(s func(interface{}), shardID, deterministicRoutingName string) int64 {
+	return n.AddSubscriptionWithMeta(s, nil, shardID, deterministicRoutingName)
+}
+
+// AddSubscriptionWithMeta is like AddSubscription, but also stores the
+// given meta in the SubscriptionEnvelope. The meta is not used by the Node.
+func (n *Node) AddSubscriptionWithMeta(s func(interface{}), meta interface{}, shardID, deterministicRoutingName string) int64 {
 	if n == nil {
 		return 0
 	}
@@ -79,6 +265,7 @@ func (n *Node) AddSubscription(s func(interface{}), shardID, deterministicRoutin
 	si := n.subscriptions[shardID]
 	si.envelopes = append(si.envelopes, SubscriptionEnvelope{
 		Subscription: s,
+		Meta:         meta,
 		id:           id,
 		dName:        deterministicRoutingName,
 	})
@@ -50,6 +50,40 @@ func TestNode(t *testing.T) {
 		Expect(t, t.n.FetchChild(1) == nil).To(BeTrue())
 	})
 
+	o.Spec("returns pattern children", func(t TN) {
+		odd := oddPattern{}
+		n1 := t.n.AddPatternChild(odd)
+		n2 := t.n.FetchPatternChild(odd)
+		Expect(t, n1).To(Equal(n2))
+		Expect(t, n1 == t.n.AddPatternChild(oddPattern{})).To(BeTrue())
+		Expect(t, t.n.ChildLen()).To(Equal(1))
+		Expect(t, t.n.PatternLen()).To(Equal(1))
+
+		var matches int
+		t.n.ForEachMatchingPatternChild(3, func(node.Pattern, *node.Node) { matches++ })
+		t.n.ForEachMatchingPatternChild(4, func(node.Pattern, *node.Node) { matches++ })
+		Expect(t, matches).To(Equal(1))
+
+		var patterns []string
+		t.n.ForEachPatternChild(func(p node.Pattern, _ *node.Node) {
+			patterns = append(patterns, p.String())
+		})
+		Expect(t, patterns).To(Equal([]string{"odd"}))
+
+		// Removes child upon deletion
+		t.n.DeletePatternChild(odd)
+		Expect(t, t.n.FetchPatternChild(odd) == nil).To(BeTrue())
+		Expect(t, t.n.ChildLen()).To(Equal(0))
+	})
+
+	o.Spec("returns the child keys in order", func(t TN) {
+		t.n.AddChild(3)
+		t.n.AddChild(1)
+		t.n.AddChild(2)
+
+		Expect(t, t.n.ChildKeys()).To(Equal([]uint64{1, 2, 3}))
+	})
+
 	o.Spec("returns all subscriptions", func(t TN) {
 		id1 := t.n.AddSubscription(func(interface{}) {}, "", "")
 
@@ -68,6 +102,18 @@ func TestNode(t *testing.T) {
 		Expect(t, t.n.SubscriptionLen()).To(Equal(2))
 	})
 
+	o.Spec("stores the meta with the subscription", func(t TN) {
+		t.n.AddSubscriptionWithMeta(func(interface{}) {}, "some-meta", "", "")
+
+		var metas []interface{}
+		t.n.ForEachSubscription(func(id string, isD bool, s []node.SubscriptionEnvelope) {
+			for _, x := range s {
+				metas = append(metas, x.Meta)
+			}
+		})
+		Expect(t, metas).To(Equal([]interface{}{"some-meta"}))
+	})
+
 	o.Spec("returns is deterministic if a single route has deterministic name", func(t TN) {
 		t.n.AddSubscription(func(interface{}) {}, "a", "")
 		t.n.AddSubscription(func(interface{}) {}, "a", "some-name")
@@ -92,13 +138,47 @@ func TestNode(t *testing.T) {
 		t.n.AddSubscription(func(interface{}) { track = append(track, 2) }, "a", "2")
 		t.n.AddSubscription(func(interface{}) { track = append(track, 1) }, "a", "1")
 
+		var names []string
 		t.n.ForEachSubscription(func(id string, isD bool, s []node.SubscriptionEnvelope) {
 			for _, x := range s {
 				x.Subscription(nil)
+				names = append(names, x.DeterministicRoutingName())
 			}
 		})
 
 		Expect(t, sort.IntsAreSorted(track)).To(Equal(true))
+		Expect(t, names).To(Equal([]string{"1", "2"}))
+	})
+
+	o.Spec("clones without changing the original", func(t TN) {
+		child := t.n.AddChild(1)
+		t.n.AddPatternChild(oddPattern{})
+		id := t.n.AddSubscription(func(interface{}) {}, "a", "")
+		t.n.AddSubscription(func(interface{}) {}, "a", "")
+
+		c := t.n.Clone()
+		Expect(t, c.FetchChild(1) == child).To(BeTrue())
+		Expect(t, c.ChildLen()).To(Equal(2))
+		Expect(t, c.SubscriptionLen()).To(Equal(2))
+
+		replacement := child.Clone()
+		c.SetChild(1, replacement)
+		c.SetPatternChild(oddPattern{}, replacement)
+		c.DeleteSubscription(id)
+		c.AddChild(2)
+
+		Expect(t, c.FetchChild(1) == replacement).To(BeTrue())
+		Expect(t, c.FetchPatternChild(oddPattern{}) == replacement).To(BeTrue())
+		Expect(t, t.n.FetchChild(1) == child).To(BeTrue())
+		Expect(t, t.n.FetchPatternChild(oddPattern{}) == replacement).To(BeFalse())
+		Expect(t, t.n.ChildLen()).To(Equal(2))
+		Expect(t, t.n.SubscriptionLen()).To(Equal(2))
+
+		var envelopes int
+		t.n.ForEachSubscription(func(_ string, _ bool, s []node.SubscriptionEnvelope) {
+			envelopes += len(s)
+		})
+		Expect(t, envelopes).To(Equal(2))
 	})
 
 	o.Spec("it handles ID collisions", func(t TN) {
@@ -109,3 +189,13 @@ func TestNode(t *testing.T) {
 		Expect(t, id1).To(Not(Equal(id2)))
 	})
 }
+
+type oddPattern struct{}
+
+func (oddPattern) String() string {
+	return "odd"
+}
+
+func (oddPattern) Match(v uint64) bool {
+	return v%2 == 1
+}
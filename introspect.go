@@ -0,0 +1,146 @@
+package pubsub
+
+import "code.cloudfoundry.org/go-pubsub/internal/node"
+
+// NodeInfo describes a node in the subscription tree. It is handed to the
+// function given to Walk.
+type NodeInfo struct {
+	// Depth is the number of path segments between the root and the node.
+	// The root has a depth of 0.
+	Depth int
+
+	// Segments are the PathSegments from the root to the node. The path
+	// handed to the Walk function holds 0 for any segment that is not
+	// Exact.
+	Segments []PathSegment
+
+	// ChildCount is the number of children the node has, including
+	// children stored under a pattern.
+	ChildCount int
+
+	// SubscriptionCounts is the number of subscriptions stored at the node
+	// per shard ID. Subscriptions without a shard ID are counted under "".
+	SubscriptionCounts map[string]int
+
+	// RoutingNames are the deterministic routing names of the
+	// subscriptions stored at the node per shard ID. The names are in the
+	// order used for routing. Shard IDs without any routing names are
+	// omitted.
+	RoutingNames map[string][]string
+}
+
+// Subscriptions returns the total number of subscriptions stored at the
+// node.
+func (i NodeInfo) Subscriptions() int {
+	var total int
+	for _, c := range i.SubscriptionCounts {
+		total += c
+	}
+	return total
+}
+
+// Walk invokes f for each node in the subscription tree, starting with the
+// root. Children are visited in ascending order of their path segment. If f
+// returns false, the node's children are not visited. Children stored under
+// a pattern are visited after the other children, in order of their
+// String. The tree can not change while it is being walked, so f should be
+// quick and must not subscribe or unsubscribe. Walk does not expose the
+// subscriptions themselves.
+func (s *Typed[T]) Walk(f func(path []uint64, info NodeInfo) bool) {
+	s.rlock()
+	defer s.runlock()
+
+	walk(s.root.Load(), nil, nil, f)
+}
+
+func walk(n *node.Node, path []uint64, segs []PathSegment, f func(path []uint64, info NodeInfo) bool) {
+	info := NodeInfo{
+		Depth:              len(path),
+		Segments:           append([]PathSegment(nil), segs...),
+		ChildCount:         n.ChildLen(),
+		SubscriptionCounts: make(map[string]int),
+		RoutingNames:       make(map[string][]string),
+	}
+
+	n.ForEachSubscription(func(shardID string, _ bool, ss []node.SubscriptionEnvelope) {
+		info.SubscriptionCounts[shardID] = len(ss)
+		for _, e := range ss {
+			if name := e.DeterministicRoutingName(); name != "" {
+				info.RoutingNames[shardID] = append(info.RoutingNames[shardID], name)
+			}
+		}
+	})
+
+	if !f(append([]uint64(nil), path...), info) {
+		return
+	}
+
+	for _, k := range n.ChildKeys() {
+		walk(n.FetchChild(k), append(path, k), append(segs, Exact(k)), f)
+	}
+
+	n.ForEachPatternChild(func(p node.Pattern, child *node.Node) {
+		walk(child, append(path, 0), append(segs, p.(PathSegment)), f)
+	})
+}
+
+// Stats summarizes the subscription tree. It is returned by Stats.
+type Stats struct {
+	// Nodes is the number of nodes in the tree, including the root.
+	Nodes int
+
+	// Subscriptions is the number of subscriptions in the tree.
+	Subscriptions int
+
+	// ShardGroups is the number of shard groups (subscriptions with the
+	// same shard ID at the same node) in the tree.
+	ShardGroups int
+
+	// MaxDepth is the depth of the deepest node.
+	MaxDepth int
+
+	// ChildFanOut maps a number of children to how many nodes have that
+	// many children.
+	ChildFanOut map[int]int
+
+	// SubscriptionFanOut maps a number of subscriptions to how many nodes
+	// have that many subscriptions.
+	SubscriptionFanOut map[int]int
+
+	// ShardGroupSizes maps a number of subscriptions to how many shard
+	// groups have that many subscriptions.
+	ShardGroupSizes map[int]int
+}
+
+// Stats walks the subscription tree and summarizes it.
+func (s *Typed[T]) Stats() Stats {
+	st := Stats{
+		ChildFanOut:        make(map[int]int),
+		SubscriptionFanOut: make(map[int]int),
+		ShardGroupSizes:    make(map[int]int),
+	}
+
+	s.Walk(func(_ []uint64, info NodeInfo) bool {
+		subs := info.Subscriptions()
+
+		st.Nodes++
+		st.Subscriptions += subs
+		st.ChildFanOut[info.ChildCount]++
+		st.SubscriptionFanOut[subs]++
+		if info.Depth > st.MaxDepth {
+			st.MaxDepth = info.Depth
+		}
+
+		for shardID, c := range info.SubscriptionCounts {
+			if shardID == "" {
+				continue
+			}
+			st.ShardGroups++
+			st.ShardGroupSizes[c]++
+		}
+
+		return true
+	})
+
+	return st
+}
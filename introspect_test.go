@@ -0,0 +1,78 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubIntrospection(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+		p := pubsub.New()
+
+		p.Subscribe(f)
+		p.Subscribe(f, pubsub.WithPath([]uint64{1, 2}))
+		p.Subscribe(f, pubsub.WithPath([]uint64{1, 2}), pubsub.WithShardID("a"), pubsub.WithDeterministicRouting("y"))
+		p.Subscribe(f, pubsub.WithPath([]uint64{1, 2}), pubsub.WithShardID("a"), pubsub.WithDeterministicRouting("x"))
+		p.Subscribe(f, pubsub.WithPath([]uint64{3}))
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            p,
+		}
+	})
+
+	o.Spec("it walks each node in order", func(t TPS) {
+		var paths [][]uint64
+		var infos []pubsub.NodeInfo
+		t.p.Walk(func(path []uint64, info pubsub.NodeInfo) bool {
+			paths = append(paths, path)
+			infos = append(infos, info)
+			return true
+		})
+
+		Expect(t, paths).To(Equal([][]uint64{nil, {1}, {1, 2}, {3}}))
+
+		Expect(t, infos[0].Depth).To(Equal(0))
+		Expect(t, infos[0].ChildCount).To(Equal(2))
+		Expect(t, infos[0].SubscriptionCounts).To(Equal(map[string]int{"": 1}))
+
+		Expect(t, infos[1].Subscriptions()).To(Equal(0))
+
+		Expect(t, infos[2].Depth).To(Equal(2))
+		Expect(t, infos[2].ChildCount).To(Equal(0))
+		Expect(t, infos[2].SubscriptionCounts).To(Equal(map[string]int{"": 1, "a": 2}))
+		Expect(t, infos[2].RoutingNames).To(Equal(map[string][]string{"a": {"x", "y"}}))
+	})
+
+	o.Spec("it does not walk the children of a skipped node", func(t TPS) {
+		var paths [][]uint64
+		t.p.Walk(func(path []uint64, info pubsub.NodeInfo) bool {
+			paths = append(paths, path)
+			return len(path) == 0
+		})
+
+		Expect(t, paths).To(Equal([][]uint64{nil, {1}, {3}}))
+	})
+
+	o.Spec("it summarizes the tree", func(t TPS) {
+		st := t.p.Stats()
+
+		Expect(t, st.Nodes).To(Equal(4))
+		Expect(t, st.Subscriptions).To(Equal(5))
+		Expect(t, st.ShardGroups).To(Equal(1))
+		Expect(t, st.MaxDepth).To(Equal(2))
+		Expect(t, st.ChildFanOut).To(Equal(map[int]int{0: 2, 1: 1, 2: 1}))
+		Expect(t, st.SubscriptionFanOut).To(Equal(map[int]int{0: 1, 1: 2, 3: 1}))
+		Expect(t, st.ShardGroupSizes).To(Equal(map[int]int{2: 1}))
+	})
+}
@@ -0,0 +1,102 @@
+package pubsub
+
+import "context"
+
+// TypedMatchSet is the set of subscriptions that data reaches. It is
+// returned by Match. Shard and consumer groups have already selected their
+// member.
+type TypedMatchSet[T any] struct {
+	s       *Typed[T]
+	data    T
+	a       TypedTreeTraverser[T]
+	subs    []*subscription[T]
+	depth   int
+	visited int
+}
+
+// MatchSet is a TypedMatchSet for data of any type. It is returned by a
+// PubSub's Match.
+type MatchSet = TypedMatchSet[interface{}]
+
+// Match traverses the subscription tree with the data like Publish does,
+// but instead of delivering the data, it returns the subscriptions that it
+// reaches. The data is delivered with the MatchSet's Deliver, possibly on
+// another goroutine. Subscriptions that subscribe in the meantime do not
+// receive the data, while subscriptions that unsubscribe in the meantime
+// are not invoked. The publish interceptors are not invoked (see
+// WithPublishInterceptor).
+func (s *Typed[T]) Match(d T, a TypedTreeTraverser[T]) TypedMatchSet[T] {
+	p := newPublish(context.Background(), d)
+	s.match(p, a, false, false)
+
+	return TypedMatchSet[T]{
+		s:       s,
+		data:    d,
+		a:       a,
+		subs:    p.matched,
+		depth:   p.depth,
+		visited: p.visited,
+	}
+}
+
+// Len returns the number of subscriptions the data reaches.
+func (m TypedMatchSet[T]) Len() int {
+	return len(m.subs)
+}
+
+// IDs returns the IDs of the subscriptions the data reaches (see
+// SubscriptionHandle.ID), in the order they are invoked.
+func (m TypedMatchSet[T]) IDs() []uint64 {
+	ids := make([]uint64, 0, len(m.subs))
+	for _, sub := range m.subs {
+		ids = append(ids, sub.id)
+	}
+	return ids
+}
+
+// Deliver hands the data to each subscription in the set, without holding
+// the PubSub's lock. The data is recorded in the history (see WithHistory)
+// and reported to the Metrics as it is delivered. Each invocation delivers
+// the data again.
+func (m TypedMatchSet[T]) Deliver() {
+	m.DeliverContext(context.Background())
+}
+
+// DeliverContext is like Deliver, but it stops delivering once the given
+// context is done, like PublishContext does.
+func (m TypedMatchSet[T]) DeliverContext(ctx context.Context) error {
+	if m.s == nil {
+		return nil
+	}
+
+	p := newPublish(ctx, m.data)
+	p.seq = m.s.record(m.data, m.a)
+	m.s.published(m.depth, m.visited)
+	p.matched = m.subs
+	p.visited = m.visited
+	p.deliver()
+
+	return p.err()
+}
+
+// match traverses the subscription tree with the publish's data while
+// holding the read lock. If record is true, the data is first recorded in
+// the history. If retain is true, it is first retained.
+func (s *Typed[T]) match(p *publish[T], a TypedTreeTraverser[T], record, retain bool) {
+	s.rlock()
+	defer s.runlock()
+
+	if record {
+		p.seq = s.record(p.data, a)
+	}
+	if retain {
+		if s.copyOnWrite {
+			// The value must not be retained while a new subscription
+			// becomes visible (see retainedVisible).
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+		}
+		s.retained.store(p.data, a, s.retainedLimit)
+	}
+	s.route(p, p.data, a, s.root.Load(), nil)
+}
@@ -0,0 +1,121 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubMatch(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	o.Spec("it returns the subscriptions the data reaches", func(t TPS) {
+		a := t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{1}))
+		t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{2}))
+		c := t.p.SubscribeHandle(t.sub)
+
+		m := t.p.Match("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, m.Len()).To(Equal(2))
+		Expect(t, m.IDs()).To(Equal([]uint64{c.ID(), a.ID()}))
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it delivers the matched subscriptions", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		m := t.p.Match("data", pubsub.LinearTreeTraverser([]uint64{1}))
+		m.Deliver()
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data"}))
+	})
+
+	o.Spec("it applies shard selection when matching", func(t TPS) {
+		p := pubsub.New(pubsub.WithDeterministicHashing(func(data interface{}) uint64 {
+			return uint64(data.(int))
+		}))
+		a := p.SubscribeHandle(t.sub, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("a"))
+		b := p.SubscribeHandle(t.sub, pubsub.WithShardID("x"), pubsub.WithDeterministicRouting("b"))
+
+		Expect(t, p.Match(0, pubsub.LinearTreeTraverser(nil)).IDs()).To(Equal([]uint64{a.ID()}))
+		Expect(t, p.Match(1, pubsub.LinearTreeTraverser(nil)).IDs()).To(Equal([]uint64{b.ID()}))
+	})
+
+	o.Spec("it is empty when no one listens", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		m := t.p.Match("data", pubsub.LinearTreeTraverser([]uint64{2}))
+
+		Expect(t, m.Len()).To(Equal(0))
+		var zero pubsub.MatchSet
+		zero.Deliver()
+	})
+
+	o.Spec("it does not invoke subscriptions that unsubscribed", func(t TPS) {
+		unsubscribe := t.p.Subscribe(t.sub)
+		m := t.p.Match("data", pubsub.LinearTreeTraverser(nil))
+
+		unsubscribe()
+		m.Deliver()
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it stops delivering once the context is done", func(t TPS) {
+		t.p.Subscribe(t.sub)
+		m := t.p.Match("data", pubsub.LinearTreeTraverser(nil))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := m.DeliverContext(ctx)
+
+		Expect(t, errors.Is(err, context.Canceled)).To(BeTrue())
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it does not hold the lock while invoking subscriptions", func(t TPS) {
+		p := pubsub.New()
+		done := make(chan struct{})
+		p.Subscribe(func(interface{}) {
+			// Subscribing from another goroutine needs the write lock.
+			go func() {
+				p.Subscribe(t.sub)
+				close(done)
+			}()
+			<-done
+		})
+
+		p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, p.Stats().Subscriptions).To(Equal(2))
+	})
+
+	o.Spec("it records the data in the history when delivered", func(t TPS) {
+		p := pubsub.New(pubsub.WithHistory(10, 0))
+		m := p.Match("data", pubsub.LinearTreeTraverser(nil))
+		p.Subscribe(t.sub, pubsub.WithReplayLast(10))
+		Expect(t, t.subscription.received()).To(HaveLen(0))
+
+		m.Deliver()
+		p.Subscribe(t.sub, pubsub.WithReplayLast(10))
+
+		Expect(t, t.subscription.received()).To(Equal([]interface{}{"data"}))
+	})
+}
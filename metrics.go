@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics collects measurements of a PubSub. It is used with WithMetrics.
+// Its methods are invoked on the goroutines that publish and invoke
+// subscriptions, often concurrently, so they should be quick and safe for
+// concurrent use. The metrics package implements it in memory and renders
+// it in the Prometheus text format.
+type Metrics interface {
+	// Published is invoked once the data of a publish has traversed the
+	// subscription tree. The depth is the depth of the deepest node the
+	// data reached and visited is the number of nodes it reached. Each
+	// item of a PublishBatch is reported on its own. Data published with
+	// Match is reported each time its MatchSet is delivered.
+	Published(depth, visited int)
+
+	// Delivered is invoked after each invocation of a subscription with
+	// the time the invocation took. A batch subscription that is handed
+	// several items at once is reported once.
+	Delivered(info DeliveryInfo, latency time.Duration)
+
+	// Dropped is invoked when the DropPolicy of a buffered subscription
+	// discards data (see WithBuffer).
+	Dropped(info DeliveryInfo, n int)
+
+	// Panicked is invoked when a subscription panics while the PubSub is
+	// configured WithPanicRecovery.
+	Panicked(info DeliveryInfo)
+
+	// Unsubscribed is invoked once a subscription is removed, either by
+	// unsubscribing or automatically (see WithTTL). Nothing is reported
+	// for the subscription afterwards: an invocation that is still in
+	// flight, e.g., the one that unsubscribed, is not reported once it
+	// finishes.
+	Unsubscribed(info DeliveryInfo)
+}
+
+// NopMetrics is a Metrics that discards every measurement. It can be
+// embedded to implement only some of the Metrics methods.
+type NopMetrics struct{}
+
+// Published implements Metrics.
+func (NopMetrics) Published(depth, visited int) {}
+
+// Delivered implements Metrics.
+func (NopMetrics) Delivered(info DeliveryInfo, latency time.Duration) {}
+
+// Dropped implements Metrics.
+func (NopMetrics) Dropped(info DeliveryInfo, n int) {}
+
+// Panicked implements Metrics.
+func (NopMetrics) Panicked(info DeliveryInfo) {}
+
+// Unsubscribed implements Metrics.
+func (NopMetrics) Unsubscribed(info DeliveryInfo) {}
+
+// WithMetrics configures a PubSub to report its measurements to the given
+// Metrics. A PubSub without Metrics does not take any measurements.
+func WithMetrics(m Metrics) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.metrics = m
+	})
+}
+
+// info describes the subscription to Metrics and DeliveryInterceptors.
+func (s *subscription[T]) info(batch bool) DeliveryInfo {
+	return DeliveryInfo{
+		ID:            s.id,
+		Path:          slices.Clone(s.path),
+		ShardID:       s.shardID,
+		RoutingName:   s.routingName,
+		ConsumerGroup: s.group,
+		Batch:         batch,
+	}
+}
+
+// measure invokes f and reports the time it took to the Metrics.
+func (s *subscription[T]) measure(batch bool, f func() error) error {
+	if s.metrics == nil {
+		return f()
+	}
+
+	start := time.Now()
+	err := f()
+	if s.beginReport() {
+		s.metrics.Delivered(s.info(batch), time.Since(start))
+	}
+	s.endReport()
+	return err
+}
+
+// dropHandler returns the function a buffered subscription reports dropped
+// data to.
+func (s *subscriber[T]) dropHandler(f func(dropped int)) func(dropped int) {
+	if s.metrics == nil {
+		return f
+	}
+
+	return func(n int) {
+		if s.beginReport() {
+			s.metrics.Dropped(s.current.Load().info(false), n)
+		}
+		s.endReport()
+		if f != nil {
+			f(n)
+		}
+	}
+}
+
+// beginReport is invoked before each report of the subscriber to the
+// Metrics. It reports false if the subscriber was removed, in which case
+// nothing may be reported anymore. Each invocation must be followed by
+// endReport.
+func (s *subscriber[T]) beginReport() bool {
+	atomic.AddInt64(&s.reports, 1)
+	return !s.isRemoved()
+}
+
+// endReport is invoked after each report of the subscriber. Once the
+// subscriber is removed, the last report to end reports Unsubscribed. This
+// keeps any other report from arriving after it.
+func (s *subscriber[T]) endReport() {
+	if atomic.AddInt64(&s.reports, -1) == 0 && s.isRemoved() &&
+		atomic.CompareAndSwapInt32(&s.unsubscribed, 0, 1) {
+		s.metrics.Unsubscribed(s.current.Load().info(false))
+	}
+}
+
+// published reports the traversal of a publish to the Metrics.
+func (s *Typed[T]) published(depth, visited int) {
+	if s.metrics != nil {
+		s.metrics.Published(depth, visited)
+	}
+}
@@ -0,0 +1,257 @@
+// Package metrics collects the measurements of a pubsub.PubSub in memory
+// and renders them in the Prometheus text format, without depending on a
+// Prometheus client library.
+package metrics
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-pubsub"
+)
+
+var (
+	// countBounds are the bucket bounds of the traversal depth and the
+	// number of visited nodes.
+	countBounds = []int64{1, 2, 4, 8, 16, 32, 64, 128, 256}
+
+	// latencyBounds are the bucket bounds of the delivery latency.
+	latencyBounds = []int64{
+		int64(10 * time.Microsecond),
+		int64(100 * time.Microsecond),
+		int64(time.Millisecond),
+		int64(10 * time.Millisecond),
+		int64(100 * time.Millisecond),
+		int64(time.Second),
+		int64(10 * time.Second),
+	}
+)
+
+// InMemory is a pubsub.Metrics that keeps the measurements in memory. It
+// is safe for concurrent use. Subscriptions are tracked by their ID and
+// are forgotten once they unsubscribe. A subscription that is moved (see
+// pubsub.SubscriptionHandle.Update) starts over with its new metadata.
+type InMemory struct {
+	depth   *histogram
+	visited *histogram
+	subs    sync.Map
+}
+
+var _ pubsub.Metrics = (*InMemory)(nil)
+
+// NewInMemory returns an InMemory without any measurements.
+func NewInMemory() *InMemory {
+	return &InMemory{
+		depth:   newHistogram(countBounds),
+		visited: newHistogram(countBounds),
+	}
+}
+
+// Published implements pubsub.Metrics.
+func (m *InMemory) Published(depth, visited int) {
+	m.depth.observe(int64(depth))
+	m.visited.observe(int64(visited))
+}
+
+// Delivered implements pubsub.Metrics.
+func (m *InMemory) Delivered(info pubsub.DeliveryInfo, latency time.Duration) {
+	m.subscription(info).latency.observe(int64(latency))
+}
+
+// Dropped implements pubsub.Metrics.
+func (m *InMemory) Dropped(info pubsub.DeliveryInfo, n int) {
+	m.subscription(info).drops.Add(uint64(n))
+}
+
+// Panicked implements pubsub.Metrics.
+func (m *InMemory) Panicked(info pubsub.DeliveryInfo) {
+	m.subscription(info).panics.Add(1)
+}
+
+// Unsubscribed implements pubsub.Metrics.
+func (m *InMemory) Unsubscribed(info pubsub.DeliveryInfo) {
+	m.subs.Delete(info.ID)
+}
+
+// subscription returns the measurements of the described subscription.
+func (m *InMemory) subscription(info pubsub.DeliveryInfo) *subscription {
+	if v, ok := m.subs.Load(info.ID); ok {
+		s := v.(*subscription)
+		if s.describes(info) {
+			return s
+		}
+
+		n := newSubscription(info)
+		if m.subs.CompareAndSwap(info.ID, s, n) {
+			return n
+		}
+		return m.subscription(info)
+	}
+
+	v, _ := m.subs.LoadOrStore(info.ID, newSubscription(info))
+	return v.(*subscription)
+}
+
+// Snapshot returns the current measurements.
+func (m *InMemory) Snapshot() Snapshot {
+	s := Snapshot{
+		Depth:   m.depth.snapshot(1),
+		Visited: m.visited.snapshot(1),
+	}
+	s.Publishes = s.Depth.Count
+
+	m.subs.Range(func(_, v interface{}) bool {
+		s.Subscriptions = append(s.Subscriptions, v.(*subscription).snapshot())
+		return true
+	})
+
+	sort.Slice(s.Subscriptions, func(i, j int) bool {
+		return s.Subscriptions[i].Info.ID < s.Subscriptions[j].Info.ID
+	})
+
+	return s
+}
+
+// Snapshot holds the measurements of an InMemory at a point in time.
+type Snapshot struct {
+	// Publishes is the number of published data points. Each item of a
+	// PublishBatch is counted on its own.
+	Publishes uint64
+
+	// Depth is the depth of the deepest node each publish reached.
+	Depth Histogram
+
+	// Visited is the number of nodes each publish reached.
+	Visited Histogram
+
+	// Subscriptions are the measurements of each subscription, ordered by
+	// ID.
+	Subscriptions []Subscription
+}
+
+// Subscription holds the measurements of a single subscription.
+type Subscription struct {
+	// Info describes the subscription. Batch is always false.
+	Info pubsub.DeliveryInfo
+
+	// Deliveries is the number of times the subscription was invoked.
+	Deliveries uint64
+
+	// Drops is the number of data points the subscription's DropPolicy
+	// discarded.
+	Drops uint64
+
+	// Panics is the number of times the subscription panicked.
+	Panics uint64
+
+	// Latency is the time each invocation took, in seconds.
+	Latency Histogram
+}
+
+// Histogram holds the distribution of observed values.
+type Histogram struct {
+	// Bounds are the inclusive upper bounds of the buckets, in ascending
+	// order.
+	Bounds []float64
+
+	// Counts are the number of observations in each bucket. It has one
+	// more entry than Bounds for the observations above the last bound.
+	Counts []uint64
+
+	// Count is the total number of observations.
+	Count uint64
+
+	// Sum is the sum of the observed values.
+	Sum float64
+}
+
+// subscription holds the measurements of a single subscription.
+type subscription struct {
+	info    pubsub.DeliveryInfo
+	latency *histogram
+	drops   atomic.Uint64
+	panics  atomic.Uint64
+}
+
+func newSubscription(info pubsub.DeliveryInfo) *subscription {
+	info.Path = slices.Clone(info.Path)
+	info.Batch = false
+
+	return &subscription{
+		info:    info,
+		latency: newHistogram(latencyBounds),
+	}
+}
+
+// describes reports whether the info has the same metadata as the
+// subscription's.
+func (s *subscription) describes(info pubsub.DeliveryInfo) bool {
+	return s.info.ShardID == info.ShardID &&
+		s.info.RoutingName == info.RoutingName &&
+		s.info.ConsumerGroup == info.ConsumerGroup &&
+		slices.Equal(s.info.Path, info.Path)
+}
+
+func (s *subscription) snapshot() Subscription {
+	info := s.info
+	info.Path = slices.Clone(info.Path)
+
+	latency := s.latency.snapshot(float64(time.Second))
+
+	return Subscription{
+		Info:       info,
+		Deliveries: latency.Count,
+		Drops:      s.drops.Load(),
+		Panics:     s.panics.Load(),
+		Latency:    latency,
+	}
+}
+
+// histogram counts observations per bucket. The last bucket holds the
+// observations above the last bound.
+type histogram struct {
+	bounds []int64
+	counts []atomic.Uint64
+	sum    atomic.Int64
+}
+
+func newHistogram(bounds []int64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(v int64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i].Add(1)
+	h.sum.Add(v)
+}
+
+// snapshot returns the histogram with its bounds and sum divided by the
+// unit.
+func (h *histogram) snapshot(unit float64) Histogram {
+	s := Histogram{
+		Bounds: make([]float64, len(h.bounds)),
+		Counts: make([]uint64, len(h.counts)),
+		Sum:    float64(h.sum.Load()) / unit,
+	}
+
+	for i, b := range h.bounds {
+		s.Bounds[i] = float64(b) / unit
+	}
+
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Load()
+		s.Count += s.Counts[i]
+	}
+
+	return s
+}
@@ -0,0 +1,132 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"code.cloudfoundry.org/go-pubsub/metrics"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TM struct {
+	*testing.T
+	m *metrics.InMemory
+	p *pubsub.PubSub
+}
+
+func TestInMemory(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TM {
+		m := metrics.NewInMemory()
+		return TM{
+			T: t,
+			m: m,
+			p: pubsub.New(pubsub.WithMetrics(m), pubsub.WithPanicRecovery()),
+		}
+	})
+
+	o.Spec("it counts publishes", func(t TM) {
+		t.p.Subscribe(func(interface{}) {}, pubsub.WithPath([]uint64{1, 2}))
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{3}))
+
+		s := t.m.Snapshot()
+		Expect(t, s.Publishes).To(Equal(uint64(2)))
+		Expect(t, s.Depth.Counts[:3]).To(Equal([]uint64{1, 1, 0}))
+		Expect(t, s.Depth.Sum).To(Equal(2.0))
+		Expect(t, s.Visited.Sum).To(Equal(4.0))
+	})
+
+	o.Spec("it counts per subscription", func(t TM) {
+		h := t.p.SubscribeHandle(func(interface{}) {}, pubsub.WithPath([]uint64{1}), pubsub.WithShardID("x"))
+		t.p.Subscribe(func(interface{}) {
+			panic("some-panic")
+		}, pubsub.WithPath([]uint64{2}))
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{2}))
+
+		s := t.m.Snapshot()
+		Expect(t, s.Subscriptions).To(HaveLen(2))
+		Expect(t, s.Subscriptions[0].Info).To(Equal(pubsub.DeliveryInfo{
+			ID:      h.ID(),
+			Path:    []uint64{1},
+			ShardID: "x",
+		}))
+		Expect(t, s.Subscriptions[0].Deliveries).To(Equal(uint64(2)))
+		Expect(t, s.Subscriptions[0].Latency.Count).To(Equal(uint64(2)))
+		Expect(t, s.Subscriptions[1].Panics).To(Equal(uint64(1)))
+	})
+
+	o.Spec("it starts over when a subscription moves", func(t TM) {
+		h := t.p.SubscribeHandle(func(interface{}) {}, pubsub.WithPath([]uint64{1}))
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		h.Update(pubsub.WithPath([]uint64{2}))
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{2}))
+
+		s := t.m.Snapshot()
+		Expect(t, s.Subscriptions).To(HaveLen(1))
+		Expect(t, s.Subscriptions[0].Info.Path).To(Equal([]uint64{2}))
+		Expect(t, s.Subscriptions[0].Deliveries).To(Equal(uint64(1)))
+	})
+
+	o.Spec("it forgets removed subscriptions", func(t TM) {
+		unsubscribe := t.p.Subscribe(func(interface{}) {})
+		t.p.Publish("data", pubsub.LinearTreeTraverser(nil))
+		unsubscribe()
+
+		Expect(t, t.m.Snapshot().Subscriptions).To(HaveLen(0))
+	})
+
+	o.Spec("it forgets subscriptions that remove themselves", func(t TM) {
+		for i := 0; i < 50; i++ {
+			var unsubscribe pubsub.Unsubscriber
+			unsubscribe = t.p.Subscribe(func(interface{}) {
+				unsubscribe()
+			})
+			t.p.Subscribe(func(interface{}) {}, pubsub.WithMaxDeliveries(1))
+		}
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.m.Snapshot().Subscriptions).To(HaveLen(0))
+	})
+
+	o.Spec("it renders the Prometheus text format", func(t TM) {
+		h := t.p.SubscribeHandle(func(interface{}) {},
+			pubsub.WithPath([]uint64{1, 2}),
+			pubsub.WithConsumerGroup(`a"b`),
+		)
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+
+		rec := httptest.NewRecorder()
+		metrics.Handler(t.m).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		Expect(t, rec.Header().Get("Content-Type")).To(StartWith("text/plain; version=0.0.4"))
+
+		body := rec.Body.String()
+		Expect(t, body).To(ContainSubstring("# TYPE pubsub_publishes_total counter\npubsub_publishes_total 1\n"))
+		Expect(t, body).To(ContainSubstring("pubsub_traversal_depth_bucket{le=\"1\"} 0\npubsub_traversal_depth_bucket{le=\"2\"} 1\n"))
+		Expect(t, body).To(ContainSubstring("pubsub_traversal_depth_bucket{le=\"+Inf\"} 1\npubsub_traversal_depth_sum 2\npubsub_traversal_depth_count 1\n"))
+
+		labels := `id="` + strconv.FormatUint(h.ID(), 10) + `",path="1/2",shard_id="",routing_name="",consumer_group="a\"b"`
+		Expect(t, body).To(ContainSubstring("pubsub_deliveries_total{" + labels + "} 1\n"))
+		Expect(t, body).To(ContainSubstring("pubsub_drops_total{" + labels + "} 0\n"))
+		Expect(t, body).To(ContainSubstring("pubsub_delivery_latency_seconds_bucket{" + labels + `,le="+Inf"} 1` + "\n"))
+		Expect(t, body).To(ContainSubstring("pubsub_delivery_latency_seconds_count{" + labels + "} 1\n"))
+
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			Expect(t, strings.HasPrefix(line, "# ") || strings.HasPrefix(line, "pubsub_")).To(BeTrue())
+		}
+	})
+}
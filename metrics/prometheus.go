@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler returns an http.Handler that renders the measurements of the
+// InMemory in the Prometheus text format (see WritePrometheus).
+func Handler(m *InMemory) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, m.Snapshot())
+	})
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text format. The
+// measurements of each subscription are labeled with its metadata: id,
+// path (the path values joined with "/"), shard_id, routing_name and
+// consumer_group.
+func WritePrometheus(w io.Writer, s Snapshot) error {
+	p := &promWriter{w: bufio.NewWriter(w)}
+
+	p.header("pubsub_publishes_total", "counter", "Number of published data points.")
+	p.sample("pubsub_publishes_total", "", float64(s.Publishes))
+
+	p.header("pubsub_traversal_depth", "histogram", "Depth of the deepest node each publish reached.")
+	p.histogram("pubsub_traversal_depth", "", s.Depth)
+
+	p.header("pubsub_visited_nodes", "histogram", "Number of nodes each publish reached.")
+	p.histogram("pubsub_visited_nodes", "", s.Visited)
+
+	labels := make([]string, len(s.Subscriptions))
+	for i, sub := range s.Subscriptions {
+		labels[i] = subscriptionLabels(sub)
+	}
+
+	p.header("pubsub_deliveries_total", "counter", "Number of times each subscription was invoked.")
+	for i, sub := range s.Subscriptions {
+		p.sample("pubsub_deliveries_total", labels[i], float64(sub.Deliveries))
+	}
+
+	p.header("pubsub_drops_total", "counter", "Number of data points each subscription's drop policy discarded.")
+	for i, sub := range s.Subscriptions {
+		p.sample("pubsub_drops_total", labels[i], float64(sub.Drops))
+	}
+
+	p.header("pubsub_panics_total", "counter", "Number of times each subscription panicked.")
+	for i, sub := range s.Subscriptions {
+		p.sample("pubsub_panics_total", labels[i], float64(sub.Panics))
+	}
+
+	p.header("pubsub_delivery_latency_seconds", "histogram", "Time each invocation of a subscription took.")
+	for i, sub := range s.Subscriptions {
+		p.histogram("pubsub_delivery_latency_seconds", labels[i], sub.Latency)
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+// subscriptionLabels returns the labels of the subscription, separated by
+// commas.
+func subscriptionLabels(s Subscription) string {
+	path := make([]string, len(s.Info.Path))
+	for i, v := range s.Info.Path {
+		path[i] = strconv.FormatUint(v, 10)
+	}
+
+	return label("id", strconv.FormatUint(s.Info.ID, 10)) + "," +
+		label("path", strings.Join(path, "/")) + "," +
+		label("shard_id", s.Info.ShardID) + "," +
+		label("routing_name", s.Info.RoutingName) + "," +
+		label("consumer_group", s.Info.ConsumerGroup)
+}
+
+// labelEscaper escapes a label value as required by the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+// promWriter writes samples until the first error.
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *promWriter) write(s ...string) {
+	for _, x := range s {
+		if p.err != nil {
+			return
+		}
+		_, p.err = p.w.WriteString(x)
+	}
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	p.write("# HELP ", name, " ", help, "\n", "# TYPE ", name, " ", typ, "\n")
+}
+
+func (p *promWriter) sample(name, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	p.write(name, labels, " ", formatFloat(v), "\n")
+}
+
+// histogram writes the cumulative buckets, the sum and the count of the
+// histogram.
+func (p *promWriter) histogram(name, labels string, h Histogram) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+
+		le := math.Inf(1)
+		if i < len(h.Bounds) {
+			le = h.Bounds[i]
+		}
+		p.sample(name+"_bucket", labels+sep+label("le", formatFloat(le)), float64(cumulative))
+	}
+
+	p.sample(name+"_sum", labels, h.Sum)
+	p.sample(name+"_count", labels, float64(h.Count))
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
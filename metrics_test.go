@@ -0,0 +1,178 @@
+package pubsub_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubMetrics(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TM {
+		s, f := newSpySubscrption()
+		m := &spyMetrics{}
+
+		return TM{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			m:            m,
+			p:            pubsub.New(pubsub.WithMetrics(m), pubsub.WithPanicRecovery()),
+		}
+	})
+
+	o.Spec("it reports the traversal of each publish", func(t TM) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1, 2, 3}))
+		t.p.PublishBatch([]interface{}{"a", "b"}, pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.m.published).To(Equal([][2]int{{2, 3}, {1, 2}, {1, 2}}))
+	})
+
+	o.Spec("it reports each delivery of a MatchSet as a publish", func(t TM) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+
+		m := t.p.Match("data", pubsub.LinearTreeTraverser([]uint64{1, 2, 3}))
+		Expect(t, t.m.published).To(HaveLen(0))
+
+		m.Deliver()
+		m.Deliver()
+		Expect(t, t.m.published).To(Equal([][2]int{{2, 3}, {2, 3}}))
+	})
+
+	o.Spec("it reports each delivery", func(t TM) {
+		h := t.p.SubscribeHandle(t.sub, pubsub.WithPath([]uint64{1}), pubsub.WithShardID("x"))
+		t.p.SubscribeBatch(func([]interface{}) {}, pubsub.WithPath([]uint64{2}))
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.PublishBatch([]interface{}{"a", "b"}, pubsub.LinearTreeTraverser([]uint64{2}))
+
+		Expect(t, t.m.delivered).To(HaveLen(2))
+		Expect(t, t.m.delivered[0]).To(Equal(pubsub.DeliveryInfo{
+			ID:      h.ID(),
+			Path:    []uint64{1},
+			ShardID: "x",
+		}))
+		Expect(t, t.m.delivered[1].Batch).To(BeTrue())
+	})
+
+	o.Spec("it reports each delivery with its own path", func(t TM) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.m.delivered[0].Path[0] = 9
+		t.p.Publish("b", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.m.delivered).To(HaveLen(2))
+		Expect(t, t.m.delivered[1].Path).To(Equal([]uint64{1}))
+	})
+
+	o.Spec("it reports dropped data", func(t TM) {
+		block := make(chan struct{})
+		defer close(block)
+		t.p.Subscribe(func(interface{}) {
+			<-block
+		}, pubsub.WithBuffer(1, pubsub.DropNewest()))
+
+		for i := 0; i < 3; i++ {
+			t.p.Publish(i, pubsub.LinearTreeTraverser(nil))
+		}
+
+		Expect(t, t.m.droppedCount).To(ViaPolling(BeAbove(0)))
+	})
+
+	o.Spec("it reports recovered panics", func(t TM) {
+		t.p.Subscribe(func(interface{}) {
+			panic("some-panic")
+		})
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.m.panicked).To(HaveLen(1))
+	})
+
+	o.Spec("it reports removed subscriptions", func(t TM) {
+		h := t.p.SubscribeHandle(t.sub)
+		h.Unsubscribe()
+		h.Unsubscribe()
+
+		Expect(t, t.m.unsubscribed).To(Equal([]uint64{h.ID()}))
+	})
+
+	o.Spec("it reports nothing after a subscription is removed", func(t TM) {
+		var unsubscribe pubsub.Unsubscriber
+		unsubscribe = t.p.Subscribe(func(interface{}) {
+			unsubscribe()
+			panic("some-panic")
+		})
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, t.m.unsubscribed).To(HaveLen(1))
+		Expect(t, t.m.delivered).To(HaveLen(0))
+		Expect(t, t.m.panicked).To(HaveLen(0))
+	})
+}
+
+type TM struct {
+	*testing.T
+	subscription *spySubscription
+	sub          func(interface{})
+	m            *spyMetrics
+	p            *pubsub.PubSub
+}
+
+type spyMetrics struct {
+	pubsub.NopMetrics
+
+	mu           sync.Mutex
+	published    [][2]int
+	delivered    []pubsub.DeliveryInfo
+	dropped      int
+	panicked     []pubsub.DeliveryInfo
+	unsubscribed []uint64
+}
+
+func (s *spyMetrics) Published(depth, visited int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, [2]int{depth, visited})
+}
+
+func (s *spyMetrics) Delivered(info pubsub.DeliveryInfo, _ time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered = append(s.delivered, info)
+}
+
+func (s *spyMetrics) Dropped(_ pubsub.DeliveryInfo, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped += n
+}
+
+func (s *spyMetrics) droppedCount() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return float64(s.dropped)
+}
+
+func (s *spyMetrics) Panicked(info pubsub.DeliveryInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.panicked = append(s.panicked, info)
+}
+
+func (s *spyMetrics) Unsubscribed(info pubsub.DeliveryInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsubscribed = append(s.unsubscribed, info.ID)
+}
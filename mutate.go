@@ -0,0 +1,97 @@
+package pubsub
+
+import "code.cloudfoundry.org/go-pubsub/internal/node"
+
+// mutate applies f to the subscription tree while holding the write lock.
+// The segments are the path f changes. When the PubSub is configured
+// WithCopyOnWrite, f is handed a copy of the tree with the nodes along that
+// path copied. If visible is not nil, it is
+// invoked while still holding the write lock once the change is visible to
+// publishes.
+func (s *Typed[T]) mutate(segs []PathSegment, f func(root *node.Node), visible func()) {
+	s.mutatePaths(func() [][]PathSegment {
+		return [][]PathSegment{segs}
+	}, f, visible)
+}
+
+// mutatePaths is like mutate, but f may change several paths. The paths are
+// only needed when the PubSub is configured WithCopyOnWrite, in which case
+// they are determined right before f is applied, while holding the write
+// lock.
+func (s *Typed[T]) mutatePaths(paths func() [][]PathSegment, f func(root *node.Node), visible func()) {
+	if visible == nil {
+		visible = func() {}
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	root := s.root.Load()
+	if s.copyOnWrite {
+		root = clonePaths(root, paths())
+	}
+
+	f(root)
+	if s.copyOnWrite {
+		s.root.Store(root)
+	}
+
+	visible()
+	s.checkInterest(root)
+}
+
+// rlock acquires the read lock for a publish or any other read of the
+// subscription tree. The tree can not change until the matching runlock,
+// so nothing that holds the read lock may subscribe, unsubscribe or update
+// a subscription. When the PubSub is configured WithCopyOnWrite, the tree
+// is never changed in place and so there is nothing to acquire.
+func (s *Typed[T]) rlock() {
+	if s.copyOnWrite {
+		return
+	}
+
+	s.mu.RLock()
+}
+
+// runlock releases the read lock acquired by rlock.
+func (s *Typed[T]) runlock() {
+	if s.copyOnWrite {
+		return
+	}
+
+	s.mu.RUnlock()
+}
+
+// lock acquires the write lock.
+func (s *Typed[T]) lock() {
+	s.mu.Lock()
+}
+
+// unlock releases the write lock and delivers the notifications of
+// OnInterestChange.
+func (s *Typed[T]) unlock() {
+	s.mu.Unlock()
+	s.notifyInterest()
+}
+
+// clonePaths returns a copy of the tree where each node along the paths
+// made of the segments is copied. The rest of the tree is shared.
+func clonePaths(root *node.Node, paths [][]PathSegment) *node.Node {
+	root = root.Clone()
+
+	for _, segs := range paths {
+		n := root
+		for _, seg := range segs {
+			child := fetchChild(n, seg)
+			if child == nil {
+				break
+			}
+
+			child = child.Clone()
+			setChild(n, seg, child)
+			n = child
+		}
+	}
+
+	return root
+}
@@ -0,0 +1,199 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// PublishError is returned by PublishContext when the context is done before
+// the data was delivered to every interested subscription.
+type PublishError struct {
+	// Err is the error returned by the context.
+	Err error
+
+	// Delivered is the number of subscriptions that were invoked before the
+	// publish was stopped.
+	Delivered int
+
+	// Visited is the number of nodes in the subscription tree that were
+	// visited before the publish was stopped. The subscriptions are only
+	// invoked once the traversal is done, so it is less than the number of
+	// nodes the data leads to only if the context was done during the
+	// traversal.
+	Visited int
+}
+
+// Error implements error.
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("publish stopped after %d deliveries and %d visited nodes: %s", e.Delivered, e.Visited, e.Err)
+}
+
+// Unwrap returns the context's error.
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// publish holds the state of a single publish while it traverses the
+// subscription tree and then delivers to the subscriptions it matched.
+type publish[T any] struct {
+	seen
+	candidates
+	expiries[T]
+
+	ctx       context.Context
+	data      T
+	seq       uint64
+	matched   []*subscription[T]
+	delivered int
+	visited   int
+	depth     int
+	ctxErr    error
+
+	// cancelable is false for contexts that are never done (e.g.,
+	// context.Background()). It avoids checking the context on every step.
+	cancelable bool
+}
+
+// maxPooledMatches bounds the capacity of the matched subscriptions that a
+// pooled publish keeps.
+const maxPooledMatches = 1024
+
+func newPublish[T any](ctx context.Context, d T) *publish[T] {
+	return &publish[T]{
+		ctx:        ctx,
+		data:       d,
+		cancelable: ctx.Done() != nil,
+	}
+}
+
+// acquirePublish is like newPublish, but it reuses a publish that was
+// released with releasePublish. It keeps Publish from allocating its state.
+func (s *Typed[T]) acquirePublish(ctx context.Context, d T) *publish[T] {
+	p, ok := s.publishes.Get().(*publish[T])
+	if !ok {
+		return newPublish(ctx, d)
+	}
+
+	p.ctx = ctx
+	p.data = d
+	p.cancelable = ctx.Done() != nil
+	return p
+}
+
+// releasePublish returns the publish to the pool. It must not be used
+// afterwards.
+func (s *Typed[T]) releasePublish(p *publish[T]) {
+	matched := p.matched
+	if cap(matched) > maxPooledMatches {
+		matched = nil
+	}
+	clear(matched)
+
+	*p = publish[T]{matched: matched[:0]}
+	s.publishes.Put(p)
+}
+
+// selects implements visitor.
+func (p *publish[T]) selects() bool {
+	return true
+}
+
+// stopped reports whether the publish's context is done.
+func (p *publish[T]) stopped() bool {
+	if !p.cancelable {
+		return false
+	}
+
+	if p.ctxErr == nil {
+		p.ctxErr = p.ctx.Err()
+	}
+
+	return p.ctxErr != nil
+}
+
+// visit implements visitor. It counts the visited nodes and tracks the
+// depth of the deepest one.
+func (p *publish[T]) visit(_ []uint64, depth int, _ node.Pattern, n *node.Node) {
+	if n == nil {
+		return
+	}
+
+	p.visited++
+	if depth > p.depth {
+		p.depth = depth
+	}
+}
+
+// reach implements visitor. It adds the envelope's subscription to the
+// matched subscriptions.
+func (p *publish[T]) reach(e node.SubscriptionEnvelope, _ string, _, _ int) {
+	p.matched = append(p.matched, e.Meta.(*subscription[T]))
+}
+
+// reachGroup implements visitor.
+func (p *publish[T]) reachGroup(_ string, _ []uint64, e node.SubscriptionEnvelope, idx, size int) {
+	p.reach(e, "", idx, size)
+}
+
+// deliver hands the published data to each matched subscription until the
+// context is done.
+func (p *publish[T]) deliver() {
+	for _, sub := range p.matched {
+		if p.stopped() {
+			return
+		}
+
+		sub.deliverLive(p.ctx, p.data, p.seq)
+		p.delivered++
+	}
+}
+
+// err returns a *PublishError if the publish was stopped.
+func (p *publish[T]) err() error {
+	if p.ctxErr == nil {
+		return nil
+	}
+
+	return &PublishError{
+		Err:       p.ctxErr,
+		Delivered: p.delivered,
+		Visited:   p.visited,
+	}
+}
+
+// seen implements the firstVisit and firstReach methods of a visitor. Its
+// maps are only allocated when they are needed.
+type seen struct {
+	visited map[*node.Node]struct{}
+	reached map[interface{}]struct{}
+}
+
+// firstVisit implements visitor.
+func (s *seen) firstVisit(n *node.Node) bool {
+	if s.visited == nil {
+		s.visited = make(map[*node.Node]struct{})
+	}
+
+	if _, ok := s.visited[n]; ok {
+		return false
+	}
+
+	s.visited[n] = struct{}{}
+	return true
+}
+
+// firstReach implements visitor.
+func (s *seen) firstReach(sub interface{}) bool {
+	if s.reached == nil {
+		s.reached = make(map[interface{}]struct{})
+	}
+
+	if _, ok := s.reached[sub]; ok {
+		return false
+	}
+
+	s.reached[sub] = struct{}{}
+	return true
+}
@@ -0,0 +1,86 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type ctxKey struct{}
+
+func TestPubSubPublishContext(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	o.Spec("it delivers and returns nil", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		err := t.p.PublishContext(context.Background(), "data", pubsub.LinearTreeTraverser([]uint64{1}))
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data"}))
+	})
+
+	o.Spec("it does not deliver with a done context", func(t TPS) {
+		t.p.Subscribe(t.sub)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := t.p.PublishContext(ctx, "data", pubsub.LinearTreeTraverser(nil))
+		Expect(t, errors.Is(err, context.Canceled)).To(BeTrue())
+		Expect(t, t.subscription.data).To(HaveLen(0))
+
+		var pErr *pubsub.PublishError
+		Expect(t, errors.As(err, &pErr)).To(BeTrue())
+		Expect(t, pErr.Delivered).To(Equal(0))
+		Expect(t, pErr.Visited).To(Equal(0))
+	})
+
+	o.Spec("it stops delivering once the context is done", func(t TPS) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		t.p.Subscribe(func(interface{}) {
+			cancel()
+		})
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		err := t.p.PublishContext(ctx, "data", pubsub.LinearTreeTraverser([]uint64{1}))
+		Expect(t, t.subscription.data).To(HaveLen(0))
+
+		var pErr *pubsub.PublishError
+		Expect(t, errors.As(err, &pErr)).To(BeTrue())
+		Expect(t, pErr.Delivered).To(Equal(1))
+		Expect(t, pErr.Visited).To(Equal(2))
+	})
+
+	o.Spec("it hands the context to context subscriptions", func(t TPS) {
+		var values []interface{}
+		t.p.SubscribeContext(func(ctx context.Context, data interface{}) {
+			values = append(values, ctx.Value(ctxKey{}))
+		})
+
+		ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+		t.p.Publish("data", pubsub.LinearTreeTraverser(nil))
+		err := t.p.PublishContext(ctx, "data", pubsub.LinearTreeTraverser(nil))
+
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, values).To(Equal([]interface{}{nil, "value"}))
+	})
+}
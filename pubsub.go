@@ -13,32 +13,59 @@
 package pubsub
 
 import (
+	"context"
 	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"code.cloudfoundry.org/go-pubsub/internal/node"
 )
 
-// PubSub uses the given SubscriptionEnroller to  create the subscription
-// tree. It also uses the TreeTraverser to then write to the subscriber. All
-// of PubSub's methods safe to access concurrently. PubSub should be
-// constructed with New().
-type PubSub struct {
-	mu                         rlocker
-	n                          *node.Node
-	rand                       func(n int64) int64
-	deterministicRoutingHasher func(interface{}) uint64
+// Typed stores subscriptions in a subscription tree according to their
+// paths. Published data is handed to the subscriptions that the
+// TypedTreeTraverser leads it to. Both the published data and the
+// subscriptions are of type T, so a mismatched traverser or subscription
+// is caught at compile time. All of Typed's methods are safe to access
+// concurrently. Typed should be constructed with NewTyped().
+type Typed[T any] struct {
+	pubsubConfig
+
+	// root is only replaced when the PubSub is configured
+	// WithCopyOnWrite. Otherwise the tree is changed in place.
+	root atomic.Pointer[node.Node]
+
+	lastID   atomic.Uint64
+	retained retainedStore[T]
+	history  history[T]
+	interest interest
+
+	// publishes pools the state of each Publish (see acquirePublish).
+	publishes sync.Pool
 }
 
+// PubSub is a Typed that publishes data of any type. It is what New()
+// returns and is what the untyped Subscription and TreeTraverser are used
+// with.
+type PubSub = Typed[interface{}]
+
 // New constructs a new PubSub.
 func New(opts ...PubSubOption) *PubSub {
-	s := &PubSub{
-		mu:   &sync.RWMutex{},
-		rand: rand.Int63n,
+	return NewTyped[interface{}](opts...)
+}
+
+// NewTyped constructs a new Typed that publishes data of type T.
+func NewTyped[T any](opts ...PubSubOption) *Typed[T] {
+	s := &Typed[T]{
+		pubsubConfig: pubsubConfig{
+			mu:    &sync.RWMutex{},
+			rand:  rand.Int63n,
+			clock: systemClock{},
+		},
 	}
 
 	for _, o := range opts {
-		o.configure(s)
+		o.configure(&s.pubsubConfig)
 	}
 
 	if s.deterministicRoutingHasher == nil {
@@ -47,45 +74,93 @@ func New(opts ...PubSubOption) *PubSub {
 		}
 	}
 
-	s.n = node.New(s.rand)
+	s.root.Store(node.New(s.rand))
 
 	return s
 }
 
+// pubsubConfig holds what a PubSubOption can configure. It is shared by
+// every Typed regardless of T.
+type pubsubConfig struct {
+	mu                         rlocker
+	rand                       func(n int64) int64
+	deterministicRoutingHasher func(interface{}) uint64
+	recoverPanics              bool
+	deadLetterHandler          DeadLetterHandler
+	publishInterceptors        []PublishInterceptor
+	deliveryInterceptors       []DeliveryInterceptor
+	metrics                    Metrics
+	atMostOnce                 bool
+	copyOnWrite                bool
+	consistentHashing          bool
+	shardStrategy              ShardStrategy
+	shardStrategies            map[string]ShardStrategy
+	retainedLimit              int
+	historyLimit               int
+	historyAge                 time.Duration
+	clock                      Clock
+}
+
 // PubSubOption is used to configure a PubSub.
 type PubSubOption interface {
-	configure(*PubSub)
+	configure(*pubsubConfig)
 }
 
-type pubsubConfigFunc func(*PubSub)
+type pubsubConfigFunc func(*pubsubConfig)
 
-func (f pubsubConfigFunc) configure(s *PubSub) {
+func (f pubsubConfigFunc) configure(s *pubsubConfig) {
 	f(s)
 }
 
 // WithNoMutex configures a PubSub that does not have any internal mutexes.
-// This is useful if more complex or custom locking is required. For example,
-// if a subscription needs to subscribe while being published to.
+// This is useful if more complex or custom locking is required.
 func WithNoMutex() PubSubOption {
-	return pubsubConfigFunc(func(s *PubSub) {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
 		s.mu = nopLock{}
 	})
 }
 
+// WithCopyOnWrite configures a PubSub that never changes its subscription
+// tree in place. Instead, each Subscribe and Unsubscribe copies the nodes
+// along the subscription's path and then atomically replaces the tree. A
+// publish therefore does not acquire any lock and traverses the tree as it
+// was when the publish started. Subscribing and unsubscribing become more
+// expensive, especially beneath nodes with many children, and still
+// serialize with each other.
+func WithCopyOnWrite() PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.copyOnWrite = true
+	})
+}
+
 // WithRand configures a PubSub that will use the given function to make
 // sharding decisions. The given function has to match the symantics of
 // math/rand.Int63n.
 func WithRand(int63 func(max int64) int64) PubSubOption {
-	return pubsubConfigFunc(func(s *PubSub) {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
 		s.rand = int63
 	})
 }
 
+// WithAtMostOnceDelivery configures a PubSub to deliver each publish at most
+// once to each node in the subscription tree, even if the TreeTraverser
+// yields paths that reach a node several times. Each shard group at a node
+// therefore also selects a subscription at most once per publish.
+// Deduplicating has a cost, and so it is disabled by default. See also
+// WithAtMostOnce.
+func WithAtMostOnceDelivery() PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.atMostOnce = true
+	})
+}
+
 // WithDeterministicHashing configures a PubSub that will use the given
 // function to hash each published data point. The hash is used only for a
-// subscription that has set its deterministic routing name.
+// subscription that has set its deterministic routing name. For a Typed,
+// the data is handed to the function as an interface{} holding a T. A
+// shard group can replace it with WithShardKey.
 func WithDeterministicHashing(hashFunction func(interface{}) uint64) PubSubOption {
-	return pubsubConfigFunc(func(s *PubSub) {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
 		s.deterministicRoutingHasher = hashFunction
 	})
 }
@@ -118,13 +193,24 @@ func WithShardID(shardID string) SubscribeOption {
 // It defaults to nil (meaning it gets everything).
 func WithPath(path []uint64) SubscribeOption {
 	return subscribeConfigFunc(func(c *subscribeConfig) {
-		c.path = path
+		c.segments = exactSegments(path)
+	})
+}
+
+// WithAtMostOnce configures a subscription to be invoked at most once per
+// publish, even if the TreeTraverser yields paths that reach it several
+// times. Unlike WithAtMostOnceDelivery, only this subscription pays for the
+// deduplication.
+func WithAtMostOnce() SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.atMostOnce = true
 	})
 }
 
 // WithDeterministicRouting configures a subscription to have a deterministic
 // routing name. A PubSub configured to use deterministic hashing will use
 // this name and the subscription's shard ID to maintain consistent routing.
+// See also WithConsistentHashing, WithShardKey and WithShardSeed.
 func WithDeterministicRouting(name string) SubscribeOption {
 	return subscribeConfigFunc(func(c *subscribeConfig) {
 		c.deterministicRoutingName = name
@@ -134,7 +220,27 @@ func WithDeterministicRouting(name string) SubscribeOption {
 type subscribeConfig struct {
 	shardID                  string
 	deterministicRoutingName string
-	path                     []uint64
+	segments                 []PathSegment
+	atMostOnce               bool
+	bufferSize               int
+	dropPolicy               DropPolicy
+	dropHandler              func(dropped int)
+	routingWeight            float64
+	shardKey                 func(interface{}) uint64
+	shardSeed                uint64
+	hasShardSeed             bool
+	group                    string
+	replay                   bool
+	replaySince              time.Time
+	replayLast               int
+	ttl                      time.Duration
+	maxDeliveries            int
+	ctx                      context.Context
+	removalHandler           func(RemovalReason)
+
+	// bufferStopped is invoked once the goroutine of a buffered
+	// subscription has exited.
+	bufferStopped func()
 }
 
 type subscribeConfigFunc func(*subscribeConfig)
@@ -146,77 +252,159 @@ func (f subscribeConfigFunc) configure(c *subscribeConfig) {
 // Subscribe will add a subscription  to the PubSub. It returns a function
 // that can be used to unsubscribe.  Options can be provided to configure
 // the subscription and its interactions with published data.
-func (s *PubSub) Subscribe(sub Subscription, opts ...SubscribeOption) Unsubscriber {
+//
+// It is safe to subscribe and unsubscribe from within a subscription, as
+// subscriptions are invoked once the subscription tree was traversed and
+// its lock released. A subscription that is added during a publish does
+// not receive that publish. A subscription that is removed during a
+// publish is not invoked again, even by the publish that is in progress.
+// The Unsubscriber is safe to invoke several times. Code that is invoked
+// while the tree is traversed, such as a TreeTraverser, a ShardStrategy or
+// the function given to Walk, must not subscribe, unsubscribe or update a
+// subscription, as it would deadlock.
+func (s *Typed[T]) Subscribe(sub func(data T), opts ...SubscribeOption) Unsubscriber {
+	return s.SubscribeContext(func(_ context.Context, data T) {
+		sub(data)
+	}, opts...)
+}
+
+// SubscribeContext is like Subscribe, but the subscription is also handed
+// the context that the data was published with. Data published with
+// Publish has a context.Background().
+func (s *Typed[T]) SubscribeContext(sub func(ctx context.Context, data T), opts ...SubscribeOption) Unsubscriber {
+	return s.subscribe(func(ctx context.Context, data T) error {
+		sub(ctx, data)
+		return nil
+	}, opts)
+}
+
+func (s *Typed[T]) subscribe(sub func(ctx context.Context, data T) error, opts []SubscribeOption) Unsubscriber {
+	c := newSubscribeConfig(opts)
+	return s.add(newSubscription(sub, nil, c, s.pubsubConfig), c).unsubscriber()
+}
+
+func newSubscribeConfig(opts []SubscribeOption) subscribeConfig {
 	c := subscribeConfig{}
 	for _, o := range opts {
 		o.configure(&c)
 	}
+	return c
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// add stores the subscription in the subscription tree and hands it any
+// retained values or the history it replays.
+func (s *Typed[T]) add(ss *subscription[T], c subscribeConfig) *SubscriptionHandle {
+	id := s.lastID.Add(1)
+	ss.id = id
+
+	h := &subscriptionHandle[T]{
+		s:   s,
+		sub: ss.subscriber,
+		c:   c,
+		rec: ss,
+	}
 
-	n := s.n
-	for _, p := range c.path {
-		n = n.AddChild(p)
+	if c.expires() {
+		ss.expireWith(h, c, s.pubsubConfig)
 	}
-	id := n.AddSubscription(sub, c.shardID, c.deterministicRoutingName)
 
-	return func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
+	visible := s.replayVisible(ss)
+	var retained []T
+	if ss.gate == nil {
+		visible = s.retainedVisible(c.segments, &retained)
+	}
+
+	s.mutate(c.segments, func(n *node.Node) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.nodeID = insert(n, ss, c)
+	}, visible)
+
+	if c.expires() {
+		h.watchExpiry(c)
+	}
 
-		s.cleanupSubscriptionTree(s.n, id, c.path)
+	if ss.gate != nil {
+		s.replay(ss, c)
+	} else {
+		deliverAll(ss, retained)
+	}
+
+	return &SubscriptionHandle{
+		id: id,
+		h:  h,
 	}
 }
 
-func (s *PubSub) cleanupSubscriptionTree(n *node.Node, id int64, p []uint64) {
+func (s *Typed[T]) cleanupSubscriptionTree(n *node.Node, id int64, p []PathSegment) {
 	if len(p) == 0 {
 		n.DeleteSubscription(id)
 		return
 	}
 
-	child := n.FetchChild(p[0])
+	child := fetchChild(n, p[0])
 	s.cleanupSubscriptionTree(child, id, p[1:])
 
 	if child.ChildLen() == 0 && child.SubscriptionLen() == 0 {
-		n.DeleteChild(p[0])
+		deleteChild(n, p[0])
 	}
 }
 
-// TreeTraverser publishes data to the correct subscriptions. Each
+// TypedTreeTraverser publishes data to the correct subscriptions. Each
 // data point can be published to several subscriptions. As the data traverses
 // the given paths, it will write to any subscribers that are assigned there.
 // Data can go down multiple paths (i.e., len(paths) > 1).
 //
 // Traversing a path ends when the return len(paths) == 0. If
-// len(paths) > 1, then each path will be traversed.
-type TreeTraverser func(data interface{}) Paths
+// len(paths) > 1, then each path will be traversed. The subscription tree
+// is locked while it is traversed, so a TypedTreeTraverser must not
+// subscribe or unsubscribe.
+type TypedTreeTraverser[T any] func(data T) TypedPaths[T]
+
+// TreeTraverser is a TypedTreeTraverser for data of any type. It is used
+// with a PubSub.
+type TreeTraverser = TypedTreeTraverser[interface{}]
 
 // LinearTreeTraverser implements TreeTraverser on behalf of a slice of paths.
 // If the data does not traverse multiple paths, then this works well.
 func LinearTreeTraverser(a []uint64) TreeTraverser {
-	return func(data interface{}) Paths {
+	return TypedLinearTreeTraverser[interface{}](a)
+}
+
+// TypedLinearTreeTraverser is the TypedTreeTraverser equivalent of
+// LinearTreeTraverser.
+func TypedLinearTreeTraverser[T any](a []uint64) TypedTreeTraverser[T] {
+	return func(data T) TypedPaths[T] {
 		if len(a) == 0 {
-			return FlatPaths(nil)
+			return TypedFlatPaths[T](nil)
 		}
 
-		return PathsWithTraverser([]uint64{a[0]}, LinearTreeTraverser(a[1:]))
+		return TypedPathsWithTraverser([]uint64{a[0]}, TypedLinearTreeTraverser[T](a[1:]))
 	}
 }
 
-// Paths is returned by a TreeTraverser. It describes how the data is
-// both assigned and how to continue to analyze it.
+// TypedPaths is returned by a TypedTreeTraverser. It describes how the data
+// is both assigned and how to continue to analyze it.
 // At will be called with idx ranging from [0, n] where n is the number
 // of valid paths. This means that the Paths needs to be prepared
 // for an idx that is greater than it has valid data for.
 //
-// If nextTraverser is nil, then the previous TreeTraverser is used.
-type Paths func(idx int, data interface{}) (path uint64, nextTraverser TreeTraverser, ok bool)
+// If nextTraverser is nil, then the previous TypedTreeTraverser is used.
+type TypedPaths[T any] func(idx int, data T) (path uint64, nextTraverser TypedTreeTraverser[T], ok bool)
+
+// Paths is TypedPaths for data of any type. It is returned by a
+// TreeTraverser.
+type Paths = TypedPaths[interface{}]
 
 // CombinePaths takes several paths and flattens it into a single path.
 func CombinePaths(p ...Paths) Paths {
+	return TypedCombinePaths(p...)
+}
+
+// TypedCombinePaths is the TypedPaths equivalent of CombinePaths.
+func TypedCombinePaths[T any](p ...TypedPaths[T]) TypedPaths[T] {
 	var currentStart int
-	return Paths(func(idx int, data interface{}) (path uint64, nextTraverser TreeTraverser, ok bool) {
+	return TypedPaths[T](func(idx int, data T) (path uint64, nextTraverser TypedTreeTraverser[T], ok bool) {
 		for _, pp := range p {
 			path, next, ok := pp(idx-currentStart, data)
 			if ok {
@@ -237,7 +425,12 @@ func CombinePaths(p ...Paths) Paths {
 // FlatPaths implements Paths for a slice of paths. It
 // returns nil for all nextTraverser meaning to use the given TreeTraverser.
 func FlatPaths(p []uint64) Paths {
-	return func(idx int, data interface{}) (uint64, TreeTraverser, bool) {
+	return TypedFlatPaths[interface{}](p)
+}
+
+// TypedFlatPaths is the TypedPaths equivalent of FlatPaths.
+func TypedFlatPaths[T any](p []uint64) TypedPaths[T] {
+	return func(idx int, data T) (uint64, TypedTreeTraverser[T], bool) {
 		if idx >= len(p) {
 			return 0, nil, false
 		}
@@ -249,7 +442,13 @@ func FlatPaths(p []uint64) Paths {
 // PathsWithTraverser implements Paths for both a slice of paths and
 // a single TreeTraverser. Each path will return the given TreeTraverser.
 func PathsWithTraverser(paths []uint64, a TreeTraverser) Paths {
-	return func(idx int, data interface{}) (uint64, TreeTraverser, bool) {
+	return TypedPathsWithTraverser(paths, a)
+}
+
+// TypedPathsWithTraverser is the TypedPaths equivalent of
+// PathsWithTraverser.
+func TypedPathsWithTraverser[T any](paths []uint64, a TypedTreeTraverser[T]) TypedPaths[T] {
+	return func(idx int, data T) (uint64, TypedTreeTraverser[T], bool) {
 		if idx >= len(paths) {
 			return 0, nil, false
 		}
@@ -258,16 +457,25 @@ func PathsWithTraverser(paths []uint64, a TreeTraverser) Paths {
 	}
 }
 
-// PathAndTraverser is a path and traverser pair.
-type PathAndTraverser struct {
+// TypedPathAndTraverser is a path and traverser pair.
+type TypedPathAndTraverser[T any] struct {
 	Path      uint64
-	Traverser TreeTraverser
+	Traverser TypedTreeTraverser[T]
 }
 
+// PathAndTraverser is a path and TreeTraverser pair.
+type PathAndTraverser = TypedPathAndTraverser[interface{}]
+
 // PathsWithTraverser implement Paths and allow a TreeTraverser to have
 // multiple paths with multiple traversers.
 func PathAndTraversers(t []PathAndTraverser) Paths {
-	return func(idx int, data interface{}) (uint64, TreeTraverser, bool) {
+	return TypedPathAndTraversers(t)
+}
+
+// TypedPathAndTraversers is the TypedPaths equivalent of
+// PathAndTraversers.
+func TypedPathAndTraversers[T any](t []TypedPathAndTraverser[T]) TypedPaths[T] {
+	return func(idx int, data T) (uint64, TypedTreeTraverser[T], bool) {
 		if idx >= len(t) {
 			return 0, nil, false
 		}
@@ -277,57 +485,219 @@ func PathAndTraversers(t []PathAndTraverser) Paths {
 }
 
 // Publish writes data using the TreeTraverser to the interested subscriptions.
-func (s *PubSub) Publish(d interface{}, a TreeTraverser) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	s.traversePublish(d, d, a, s.n)
+// The subscriptions are invoked once the data has traversed the
+// subscription tree, without holding the PubSub's lock. It is the
+// equivalent of Match followed by Deliver.
+func (s *Typed[T]) Publish(d T, a TypedTreeTraverser[T]) {
+	s.publishContext(context.Background(), d, a, false)
+}
+
+// PublishContext is like Publish, but it stops delivering once the given
+// context is done. The context is checked before visiting each node in the
+// subscription tree and before invoking each subscription. If the publish
+// was stopped, a *PublishError that states how far the delivery got is
+// returned. Subscriptions that subscribed with SubscribeContext are handed
+// the context.
+func (s *Typed[T]) PublishContext(ctx context.Context, d T, a TypedTreeTraverser[T]) error {
+	return s.publishContext(ctx, d, a, false)
 }
 
-func (s *PubSub) traversePublish(d, next interface{}, a TreeTraverser, n *node.Node) {
+// publishContext sends the data through the publish interceptors. If retain
+// is true, the data that comes out of them is also retained.
+func (s *Typed[T]) publishContext(ctx context.Context, d T, a TypedTreeTraverser[T], retain bool) error {
+	if len(s.publishInterceptors) == 0 {
+		return s.send(ctx, d, a, retain)
+	}
+
+	var err error
+	s.intercept(ctx, d, func(ctx context.Context, data interface{}) {
+		err = s.send(ctx, intercepted[T](data), a, retain)
+	})
+	return err
+}
+
+// send traverses the subscription tree with the data and then delivers it.
+func (s *Typed[T]) send(ctx context.Context, d T, a TypedTreeTraverser[T], retain bool) error {
+	p := s.acquirePublish(ctx, d)
+	s.match(p, a, true, retain)
+	s.published(p.depth, p.visited)
+	p.expireAll()
+	p.deliver()
+
+	err := p.err()
+	s.releasePublish(p)
+	return err
+}
+
+// visitor is notified as data traverses the subscription tree.
+type visitor interface {
+	// stopped reports whether the traversal should stop.
+	stopped() bool
+
+	// visit is invoked for each path the data traverses. depth is the
+	// length of the path. The path itself is nil unless the traversal was
+	// started with a non-nil path, which is only needed by visitors that
+	// report it. The pattern is nil unless the node is a pattern child. The
+	// node is nil if the path does not exist in the subscription tree.
+	visit(path []uint64, depth int, pattern node.Pattern, n *node.Node)
+
+	// firstVisit reports whether this is the first time the traversal has
+	// visited the node. It is used to deliver at most once to
+	// subscriptions that have a pattern in their path.
+	firstVisit(n *node.Node) bool
+
+	// firstReach reports whether this is the first time the traversal has
+	// reached the subscription. It is used to deliver at most once to
+	// subscriptions configured WithAtMostOnce.
+	firstReach(sub interface{}) bool
+
+	// reach is invoked for each subscription the data reaches. For a
+	// subscription with a shard ID, idx is its index within the shard group
+	// of the given size.
+	reach(e node.SubscriptionEnvelope, shardID string, idx, size int)
+
+	// groupCandidates returns the members of each consumer group the data
+	// has reached.
+	groupCandidates() *candidates
+
+	// reachGroup is invoked with the member selected from each consumer
+	// group and the path it subscribed with. idx is its index within the
+	// candidates of the given size.
+	reachGroup(group string, path []uint64, e node.SubscriptionEnvelope, idx, size int)
+
+	// selects reports whether the selected members of shard and consumer
+	// groups are handed the data. A ShardStrategy's selections are then
+	// recorded as they are made.
+	selects() bool
+
+	// expired is invoked with each subscription that the data did not
+	// reach because it outlived its TTL.
+	expired(sub interface{})
+}
+
+// route traverses the subscription tree with the data and then reaches the
+// selected member of each consumer group. The traversed path is only built
+// if path is not nil (see visitor.visit).
+func (s *Typed[T]) route(v visitor, d T, a TypedTreeTraverser[T], root *node.Node, path []uint64) {
+	s.traverse(v, d, a, root, path, 0, nil, s.atMostOnce)
+	s.reachGroups(v, d)
+}
+
+// traverse walks the subscription tree with the data. If once is true, the
+// subscriptions of a node that has already been visited are skipped. It is
+// set for any node beneath a pattern child.
+func (s *Typed[T]) traverse(v visitor, d T, a TypedTreeTraverser[T], n *node.Node, path []uint64, depth int, pattern node.Pattern, once bool) {
+	if v.stopped() {
+		return
+	}
+
+	v.visit(path, depth, pattern, n)
 	if n == nil {
 		return
 	}
+
+	if !once || v.firstVisit(n) {
+		s.reachSubscriptions(v, d, n)
+	}
+
+	if v.stopped() {
+		return
+	}
+
+	paths := a(d)
+
+	for i := 0; ; i++ {
+		child, nextA, ok := paths(i, d)
+		if !ok {
+			return
+		}
+
+		if nextA == nil {
+			nextA = a
+		}
+
+		childPath := path
+		if path != nil {
+			childPath = append(path, child)
+		}
+		s.traverse(v, d, nextA, n.FetchChild(child), childPath, depth+1, nil, once)
+
+		if n.PatternLen() == 0 {
+			continue
+		}
+
+		n.ForEachMatchingPatternChild(child, func(p node.Pattern, c *node.Node) {
+			s.traverse(v, d, nextA, c, childPath, depth+1, p, true)
+		})
+	}
+}
+
+// reachSubscriptions notifies the visitor of each subscription at the node
+// that the data reaches.
+func (s *Typed[T]) reachSubscriptions(v visitor, d T, n *node.Node) {
 	n.ForEachSubscription(func(shardID string, isDeterministic bool, ss []node.SubscriptionEnvelope) {
 		if shardID == "" {
 			for _, x := range ss {
-				x.Subscription(d)
+				if v.stopped() {
+					return
+				}
+
+				if !available(v, x.Meta.(*subscription[T])) || s.alreadyReached(v, x) {
+					continue
+				}
+				s.reach(v, x, shardID, 0, 0)
 			}
 			return
 		}
 
-		idx := s.determineIdx(d, len(ss), isDeterministic)
-		ss[idx].Subscription(d)
-	})
+		if v.stopped() {
+			return
+		}
 
-	paths := a(next)
+		idx := s.determineIdx(v, d, shardID, ss, isDeterministic)
+		if idx < 0 || idx >= int64(len(ss)) {
+			return
+		}
 
-	for i := 0; ; i++ {
-		child, nextA, ok := paths(i, next)
-		if !ok {
+		if idx = nextAvailable[T](v, ss, idx); idx < 0 {
 			return
 		}
 
-		if nextA == nil {
-			nextA = a
+		if s.alreadyReached(v, ss[idx]) {
+			return
 		}
+		s.reach(v, ss[idx], shardID, int(idx), len(ss))
+	})
+}
 
-		c := n.FetchChild(child)
+// alreadyReached reports whether a subscription configured WithAtMostOnce
+// was already reached by the traversal.
+func (s *Typed[T]) alreadyReached(v visitor, e node.SubscriptionEnvelope) bool {
+	sub := e.Meta.(*subscription[T])
+	return sub.atMostOnce && !v.firstReach(sub)
+}
 
-		s.traversePublish(d, next, nextA, c)
+func (s *Typed[T]) determineIdx(v visitor, d T, shardID string, ss []node.SubscriptionEnvelope, isDeterministic bool) int64 {
+	if st := s.shardStrategyFor(shardID); st != nil {
+		return selectMember[T](v, st, d, ss)
 	}
-}
 
-func (s *PubSub) determineIdx(d interface{}, l int, isDeterministic bool) int64 {
-	if isDeterministic {
-		return int64(s.deterministicRoutingHasher(d) % uint64(l))
+	if !isDeterministic {
+		return s.rand(int64(len(ss)))
 	}
-	return s.rand(int64(l))
+
+	hash := s.shardHash(d, ss)
+	if s.consistentHashing {
+		return rendezvousIdx[T](hash, ss)
+	}
+	return int64(hash % uint64(len(ss)))
 }
 
 // rlocker is used to hold either a real sync.RWMutex or a nop lock.
 // This is used to turn off locking.
 type rlocker interface {
 	sync.Locker
+	TryLock() bool
 	RLock()
 	RUnlock()
 }
@@ -342,6 +712,9 @@ func (l nopLock) Lock() {}
 // Unlock implements rlocker.
 func (l nopLock) Unlock() {}
 
+// TryLock implements rlocker.
+func (l nopLock) TryLock() bool { return true }
+
 // RLock implements rlocker.
 func (l nopLock) RLock() {}
 
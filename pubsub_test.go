@@ -103,6 +103,91 @@ func TestPubSub(t *testing.T) {
 		t.p.Publish(&testStruct{a: 1, b: 2}, testStructTravTraverse)
 		Expect(t, sub.data).To(HaveLen(0))
 	})
+
+	o.Spec("it is safe to invoke the unsubscriber several times", func(t TPS) {
+		unsubscribe := t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 2}))
+		unsubscribe()
+		unsubscribe()
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it unsubscribes from within a subscription", func(t TPS) {
+		var unsubscribe pubsub.Unsubscriber
+		unsubscribe = t.p.Subscribe(func(data interface{}) {
+			t.sub(data)
+			unsubscribe()
+		}, pubsub.WithPath([]uint64{1}))
+
+		other, f := newSpySubscrption()
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+
+		t.p.Publish("data-1", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.Publish("data-2", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data-1"}))
+		Expect(t, other.data).To(Equal([]interface{}{"data-1", "data-2"}))
+	})
+
+	o.Spec("it does not invoke a subscription removed during the publish", func(t TPS) {
+		unsubscribe := t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+		t.p.Subscribe(func(interface{}) {
+			unsubscribe()
+		})
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+	})
+
+	o.Spec("it subscribes from within a subscription", func(t TPS) {
+		var once sync.Once
+		t.p.Subscribe(func(interface{}) {
+			once.Do(func() {
+				t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+			})
+		})
+
+		t.p.Publish("data-1", pubsub.LinearTreeTraverser([]uint64{1}))
+		t.p.Publish("data-2", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data-2"}))
+	})
+
+	o.Spec("it subscribes before returning while others publish", func(t TPS) {
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						t.p.Publish("other", pubsub.LinearTreeTraverser([]uint64{2}))
+					}
+				}
+			}()
+		}
+
+		var missed int
+		for i := 0; i < 1000; i++ {
+			sub, f := newSpySubscrption()
+			unsubscribe := t.p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+			t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+			if len(sub.received()) != 1 {
+				missed++
+			}
+			unsubscribe()
+		}
+		close(done)
+		wg.Wait()
+
+		Expect(t, missed).To(Equal(0))
+	})
 }
 
 func TestPubSubWithShardID(t *testing.T) {
@@ -257,3 +342,9 @@ func newSpySubscrption() (*spySubscription, func(interface{})) {
 		s.data = append(s.data, data)
 	}
 }
+
+func (s *spySubscription) received() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]interface{}(nil), s.data...)
+}
@@ -0,0 +1,241 @@
+package pubsub
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"sync"
+)
+
+const (
+	// maxRetainedDepth and maxRetainedPaths bound how far PublishRetained
+	// follows a TreeTraverser to find its leaves.
+	maxRetainedDepth = 64
+	maxRetainedPaths = 4096
+)
+
+// WithRetainedLimit configures the maximum number of retained values a
+// PubSub stores. Once the limit is reached, the value that was retained
+// the longest time ago is discarded. A limit less than 1 means there is no
+// limit, which is the default.
+func WithRetainedLimit(limit int) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.retainedLimit = limit
+	})
+}
+
+// PublishRetained publishes the data like Publish does, and also retains
+// it. The data is retained for each leaf of the TreeTraverser, i.e., each
+// path that the TreeTraverser ends. A later PublishRetained with the same
+// leaf replaces it. Each new subscription is handed the retained values of
+// every leaf that its path leads to, as if they were published right after
+// it subscribed. This includes members of shard and consumer groups. Data
+// that is retained for several matching leaves is only handed over once,
+// and a subscription is either handed a retained value or reached by its
+// publish, never both.
+//
+// The data is retained as it traverses the subscription tree, and so the
+// value that is retained is the one the publish interceptors pass on. Data
+// that an interceptor does not pass on is not retained. With
+// WithCopyOnWrite, PublishRetained holds the read lock while it traverses
+// the tree.
+//
+// The TreeTraverser must end each path. Paths are followed at most 64
+// deep, and at most 4096 paths are followed per publish.
+func (s *Typed[T]) PublishRetained(d T, a TypedTreeTraverser[T]) {
+	s.publishContext(context.Background(), d, a, true)
+}
+
+// ClearRetained discards the retained values of each leaf that the given
+// segments lead to, the same way a subscription's path leads to them. No
+// segments discards every retained value. It returns the number of
+// discarded leaves.
+func (s *Typed[T]) ClearRetained(segments ...PathSegment) int {
+	return s.retained.clear(segments)
+}
+
+// RetainedLen returns the number of leaves that have a retained value.
+func (s *Typed[T]) RetainedLen() int {
+	s.retained.mu.Lock()
+	defer s.retained.mu.Unlock()
+	return len(s.retained.leaves)
+}
+
+// retainedStore stores the retained value of each leaf. The list orders
+// the leaves from the least to the most recently retained.
+type retainedStore[T any] struct {
+	mu     sync.Mutex
+	leaves map[string]*list.Element
+	order  list.List
+}
+
+// retainedLeaf is stored in the list of a retainedStore. Leaves of the
+// same publish share the value.
+type retainedLeaf[T any] struct {
+	key   string
+	path  []uint64
+	value *retainedValue[T]
+}
+
+type retainedValue[T any] struct {
+	data T
+}
+
+// store retains the data for each leaf of the TreeTraverser.
+func (r *retainedStore[T]) store(d T, a TypedTreeTraverser[T], limit int) {
+	v := &retainedValue[T]{data: d}
+
+	var paths [][]uint64
+	budget := maxRetainedPaths
+	traverseLeaves(d, a, nil, &budget, func(path []uint64) {
+		paths = append(paths, append([]uint64(nil), path...))
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.leaves == nil {
+		r.leaves = make(map[string]*list.Element)
+	}
+
+	for _, path := range paths {
+		key := retainedKey(path)
+		if e, ok := r.leaves[key]; ok {
+			r.order.Remove(e)
+		}
+		r.leaves[key] = r.order.PushBack(&retainedLeaf[T]{
+			key:   key,
+			path:  path,
+			value: v,
+		})
+	}
+
+	for limit > 0 && len(r.leaves) > limit {
+		e := r.order.Front()
+		r.order.Remove(e)
+		delete(r.leaves, e.Value.(*retainedLeaf[T]).key)
+	}
+}
+
+// matching returns the retained values of each leaf the segments lead to,
+// from the least to the most recently retained. Each value is only
+// returned once.
+func (r *retainedStore[T]) matching(segs []PathSegment) []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		ds   []T
+		seen map[*retainedValue[T]]struct{}
+	)
+	for e := r.order.Front(); e != nil; e = e.Next() {
+		l := e.Value.(*retainedLeaf[T])
+		if !leadsTo(segs, l.path) {
+			continue
+		}
+
+		if seen == nil {
+			seen = make(map[*retainedValue[T]]struct{})
+		}
+		if _, ok := seen[l.value]; ok {
+			continue
+		}
+		seen[l.value] = struct{}{}
+
+		ds = append(ds, l.value.data)
+	}
+	return ds
+}
+
+// clear discards the retained values of each leaf the segments lead to.
+func (r *retainedStore[T]) clear(segs []PathSegment) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var cleared int
+	for e := r.order.Front(); e != nil; {
+		next := e.Next()
+		l := e.Value.(*retainedLeaf[T])
+		if leadsTo(segs, l.path) {
+			r.order.Remove(e)
+			delete(r.leaves, l.key)
+			cleared++
+		}
+		e = next
+	}
+	return cleared
+}
+
+// retainedVisible returns the function that mutate invokes once the
+// subscription is visible to publishes. It takes the retained values its
+// path leads to and stores them in ds. Any value that is retained
+// afterwards reaches the subscription when it is published.
+func (s *Typed[T]) retainedVisible(segs []PathSegment, ds *[]T) func() {
+	return func() {
+		*ds = s.retained.matching(segs)
+	}
+}
+
+func deliverAll[T any](ss *subscription[T], ds []T) {
+	for _, d := range ds {
+		ss.deliver(context.Background(), d)
+	}
+}
+
+// traverseLeaves invokes f with each path that the TreeTraverser ends.
+// budget is the number of paths that may still be followed.
+func traverseLeaves[T any](d T, a TypedTreeTraverser[T], path []uint64, budget *int, f func(path []uint64)) {
+	if len(path) == maxRetainedDepth {
+		f(path)
+		return
+	}
+
+	paths := a(d)
+
+	var i int
+	for ; ; i++ {
+		if *budget == 0 {
+			return
+		}
+
+		child, nextA, ok := paths(i, d)
+		if !ok {
+			break
+		}
+		*budget--
+
+		if nextA == nil {
+			nextA = a
+		}
+
+		traverseLeaves(d, nextA, append(path, child), budget, f)
+	}
+
+	if i == 0 {
+		f(path)
+	}
+}
+
+// leadsTo reports whether a subscription with the given segments is reached
+// by data that traverses the path.
+func leadsTo(segs []PathSegment, path []uint64) bool {
+	if len(segs) > len(path) {
+		return false
+	}
+
+	for i, seg := range segs {
+		if !seg.Match(path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// retainedKey encodes a path as a map key.
+func retainedKey(path []uint64) string {
+	b := make([]byte, 8*len(path))
+	for i, v := range path {
+		binary.BigEndian.PutUint64(b[8*i:], v)
+	}
+	return string(b)
+}
@@ -0,0 +1,148 @@
+package pubsub_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubRetained(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	o.Spec("it hands retained values to a new subscription", func(t TPS) {
+		early, f := newSpySubscrption()
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1}))
+
+		t.p.PublishRetained("a", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		t.p.PublishRetained("b", pubsub.LinearTreeTraverser([]uint64{1, 3}))
+		t.p.PublishRetained("c", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		t.p.PublishRetained("d", pubsub.LinearTreeTraverser([]uint64{2}))
+
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1}))
+
+		Expect(t, early.data).To(Equal([]interface{}{"a", "b", "c"}))
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"b", "c"}))
+		Expect(t, t.p.RetainedLen()).To(Equal(3))
+	})
+
+	o.Spec("it only hands over values whose leaf the path leads to", func(t TPS) {
+		exact, f := newSpySubscrption()
+		t.p.PublishRetained("a", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+
+		t.p.Subscribe(t.sub, pubsub.WithPath([]uint64{1, 3}))
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1, 2}))
+
+		Expect(t, t.subscription.data).To(HaveLen(0))
+		Expect(t, exact.data).To(Equal([]interface{}{"a"}))
+	})
+
+	o.Spec("it hands over a value with several matching leaves once", func(t TPS) {
+		t.p.PublishRetained("a", func(interface{}) pubsub.Paths {
+			return pubsub.PathsWithTraverser([]uint64{1, 2}, pubsub.LinearTreeTraverser([]uint64{3}))
+		})
+
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.Wildcard()))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"a"}))
+		Expect(t, t.p.RetainedLen()).To(Equal(2))
+	})
+
+	o.Spec("it discards the oldest value beyond the limit", func(t TPS) {
+		p := pubsub.New(pubsub.WithRetainedLimit(2))
+		p.PublishRetained("a", pubsub.LinearTreeTraverser([]uint64{1}))
+		p.PublishRetained("b", pubsub.LinearTreeTraverser([]uint64{2}))
+		p.PublishRetained("c", pubsub.LinearTreeTraverser([]uint64{1}))
+		p.PublishRetained("d", pubsub.LinearTreeTraverser([]uint64{3}))
+
+		p.Subscribe(t.sub)
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"c", "d"}))
+	})
+
+	o.Spec("it clears retained values", func(t TPS) {
+		t.p.PublishRetained("a", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		t.p.PublishRetained("b", pubsub.LinearTreeTraverser([]uint64{1, 3}))
+		t.p.PublishRetained("c", pubsub.LinearTreeTraverser([]uint64{2}))
+
+		Expect(t, t.p.ClearRetained(pubsub.Exact(1), pubsub.NotIn(3))).To(Equal(1))
+		t.p.Subscribe(t.sub)
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"b", "c"}))
+
+		Expect(t, t.p.ClearRetained()).To(Equal(2))
+		Expect(t, t.p.RetainedLen()).To(Equal(0))
+	})
+
+	o.Spec("it hands retained values to a buffered subscription", func(t TPS) {
+		sub := newBlockingSubscription()
+		sub.release()
+		t.p.PublishRetained("a", pubsub.LinearTreeTraverser(nil))
+
+		t.p.Subscribe(sub.f, pubsub.WithBuffer(1, pubsub.DropNewest()))
+
+		Expect(t, sub.received).To(ViaPolling(Equal([]interface{}{"a"})))
+	})
+
+	o.Spec("it retains the value the publish interceptors pass on", func(t TPS) {
+		p := pubsub.New(pubsub.WithPublishInterceptor(func(ctx context.Context, data interface{}, next func(context.Context, interface{})) {
+			switch data {
+			case "drop":
+			case "secret":
+				next(ctx, "redacted")
+			default:
+				next(ctx, data)
+			}
+		}))
+		p.PublishRetained("secret", pubsub.LinearTreeTraverser([]uint64{1}))
+		p.PublishRetained("drop", pubsub.LinearTreeTraverser([]uint64{2}))
+
+		p.Subscribe(t.sub)
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"redacted"}))
+		Expect(t, p.RetainedLen()).To(Equal(1))
+	})
+
+	o.Spec("it hands a value to a concurrent subscription once", func(t TPS) {
+		for _, opts := range [][]pubsub.PubSubOption{nil, {pubsub.WithCopyOnWrite()}} {
+			for i := 0; i < 100; i++ {
+				p := pubsub.New(opts...)
+				var received int64
+
+				var wg sync.WaitGroup
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					p.PublishRetained("a", pubsub.LinearTreeTraverser([]uint64{1}))
+				}()
+				go func() {
+					defer wg.Done()
+					p.Subscribe(func(interface{}) {
+						atomic.AddInt64(&received, 1)
+					}, pubsub.WithPath([]uint64{1}))
+				}()
+				wg.Wait()
+
+				Expect(t, func() int64 {
+					return atomic.LoadInt64(&received)
+				}).To(ViaPolling(Equal(int64(1))))
+			}
+		}
+	})
+}
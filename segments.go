@@ -0,0 +1,208 @@
+package pubsub
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// PathSegment is a single segment of a subscription's path. It decides
+// which path values yielded by a TreeTraverser reach the subscription.
+// PathSegments are created with Exact, AnyOf, NotIn and Wildcard. The zero
+// value is a Wildcard.
+type PathSegment struct {
+	kind   segmentKind
+	values []uint64
+}
+
+type segmentKind int
+
+const (
+	wildcardSegment segmentKind = iota
+	exactSegment
+	anyOfSegment
+	notInSegment
+)
+
+// Exact returns a PathSegment that matches only the given path value. It is
+// the equivalent of each value given to WithPath.
+func Exact(v uint64) PathSegment {
+	return PathSegment{kind: exactSegment, values: []uint64{v}}
+}
+
+// AnyOf returns a PathSegment that matches any of the given path values.
+func AnyOf(vs ...uint64) PathSegment {
+	vs = sortedUnique(vs)
+	if len(vs) == 1 {
+		return Exact(vs[0])
+	}
+
+	return PathSegment{kind: anyOfSegment, values: vs}
+}
+
+// NotIn returns a PathSegment that matches any path value except the given
+// ones and 0. Generated TreeTraversers yield 0 for each field, whatever its
+// value, so matching 0 would let excluded values through. Without any
+// values, NotIn returns a Wildcard.
+func NotIn(vs ...uint64) PathSegment {
+	vs = sortedUnique(vs)
+	if len(vs) == 0 {
+		return Wildcard()
+	}
+
+	return PathSegment{kind: notInSegment, values: vs}
+}
+
+// Wildcard returns a PathSegment that matches any path value.
+func Wildcard() PathSegment {
+	return PathSegment{kind: wildcardSegment}
+}
+
+// Match reports whether the given path value matches the PathSegment.
+func (s PathSegment) Match(v uint64) bool {
+	switch s.kind {
+	case exactSegment:
+		return s.values[0] == v
+	case anyOfSegment:
+		return s.contains(v)
+	case notInSegment:
+		return v != 0 && !s.contains(v)
+	default:
+		return true
+	}
+}
+
+// String renders the PathSegment. An Exact segment is rendered as its
+// value, AnyOf as {1,2}, NotIn as !{1,2} and Wildcard as *.
+func (s PathSegment) String() string {
+	switch s.kind {
+	case exactSegment:
+		return strconv.FormatUint(s.values[0], 10)
+	case anyOfSegment:
+		return s.valuesString()
+	case notInSegment:
+		return "!" + s.valuesString()
+	default:
+		return "*"
+	}
+}
+
+func (s PathSegment) isExact() bool {
+	return s.kind == exactSegment
+}
+
+// value returns the value of an Exact segment and 0 for any other.
+func (s PathSegment) value() uint64 {
+	if !s.isExact() {
+		return 0
+	}
+	return s.values[0]
+}
+
+func (s PathSegment) contains(v uint64) bool {
+	i := sort.Search(len(s.values), func(i int) bool { return s.values[i] >= v })
+	return i < len(s.values) && s.values[i] == v
+}
+
+func (s PathSegment) valuesString() string {
+	ss := make([]string, 0, len(s.values))
+	for _, v := range s.values {
+		ss = append(ss, strconv.FormatUint(v, 10))
+	}
+	return "{" + strings.Join(ss, ",") + "}"
+}
+
+// WithSegments configures a subscription to reside at a path made of the
+// given PathSegments. It is a more expressive version of WithPath: each
+// segment can match several path values. A subscription with any segment
+// that is not Exact receives each publish at most once, even if the
+// published data matches the segment with several path values.
+//
+// Generated TreeTraversers reserve the path value 0 for subscriptions that
+// do not filter on a field and yield it alongside the field's value.
+// Wildcard matches 0 as well, AnyOf only if it is given, and NotIn never
+// does. Data that only yields 0 for a field, e.g., for a nil pointer, does
+// not reach a NotIn segment.
+func WithSegments(segments ...PathSegment) SubscribeOption {
+	return subscribeConfigFunc(func(c *subscribeConfig) {
+		c.segments = segments
+	})
+}
+
+// addChild returns the child of the node for the segment, creating it if
+// necessary.
+func addChild(n *node.Node, seg PathSegment) *node.Node {
+	if seg.isExact() {
+		return n.AddChild(seg.value())
+	}
+	return n.AddPatternChild(seg)
+}
+
+// fetchChild returns the child of the node for the segment.
+func fetchChild(n *node.Node, seg PathSegment) *node.Node {
+	if seg.isExact() {
+		return n.FetchChild(seg.value())
+	}
+	return n.FetchPatternChild(seg)
+}
+
+// setChild stores the child of the node for the segment.
+func setChild(n *node.Node, seg PathSegment, child *node.Node) {
+	if seg.isExact() {
+		n.SetChild(seg.value(), child)
+		return
+	}
+	n.SetPatternChild(seg, child)
+}
+
+// deleteChild removes the child of the node for the segment.
+func deleteChild(n *node.Node, seg PathSegment) {
+	if seg.isExact() {
+		n.DeleteChild(seg.value())
+		return
+	}
+	n.DeletePatternChild(seg)
+}
+
+// exactSegments converts a path into Exact segments.
+func exactSegments(path []uint64) []PathSegment {
+	if path == nil {
+		return nil
+	}
+
+	segs := make([]PathSegment, 0, len(path))
+	for _, v := range path {
+		segs = append(segs, Exact(v))
+	}
+	return segs
+}
+
+// segmentValues converts segments into a path. Segments that are not Exact
+// are converted to 0.
+func segmentValues(segs []PathSegment) []uint64 {
+	if segs == nil {
+		return nil
+	}
+
+	path := make([]uint64, 0, len(segs))
+	for _, s := range segs {
+		path = append(path, s.value())
+	}
+	return path
+}
+
+func sortedUnique(vs []uint64) []uint64 {
+	vs = append([]uint64(nil), vs...)
+	sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+
+	var r []uint64
+	for i, v := range vs {
+		if i > 0 && vs[i-1] == v {
+			continue
+		}
+		r = append(r, v)
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+func TestPubSubSegments(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TPS {
+		s, f := newSpySubscrption()
+
+		return TPS{
+			T:            t,
+			sub:          f,
+			subscription: s,
+			p:            pubsub.New(),
+		}
+	})
+
+	o.Spec("it matches any of the values", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.Exact(1), pubsub.AnyOf(2, 3)))
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+		t.p.Publish("b", pubsub.LinearTreeTraverser([]uint64{1, 3}))
+		t.p.Publish("c", pubsub.LinearTreeTraverser([]uint64{1, 4}))
+		t.p.Publish("d", pubsub.LinearTreeTraverser([]uint64{2, 2}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"a", "b"}))
+	})
+
+	o.Spec("it matches anything but the values", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.NotIn(2, 3), pubsub.Exact(1)))
+
+		t.p.Publish("a", pubsub.LinearTreeTraverser([]uint64{1, 1}))
+		t.p.Publish("b", pubsub.LinearTreeTraverser([]uint64{2, 1}))
+		t.p.Publish("c", pubsub.LinearTreeTraverser([]uint64{3, 1}))
+		t.p.Publish("d", pubsub.LinearTreeTraverser([]uint64{4, 1}))
+		t.p.Publish("e", pubsub.LinearTreeTraverser([]uint64{4, 2}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"a", "d"}))
+	})
+
+	o.Spec("it does not match the reserved 0 with NotIn", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.NotIn(9)))
+
+		// Like a generated TreeTraverser, yield 0 and the value.
+		traverser := func(v uint64) pubsub.TreeTraverser {
+			return func(interface{}) pubsub.Paths {
+				return pubsub.FlatPaths([]uint64{0, v})
+			}
+		}
+		t.p.Publish("a", traverser(9))
+		t.p.Publish("b", traverser(8))
+		t.p.Publish("c", pubsub.LinearTreeTraverser([]uint64{0}))
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"b"}))
+		Expect(t, pubsub.NotIn(9).Match(0)).To(BeFalse())
+	})
+
+	o.Spec("it delivers at most once per publish", func(t TPS) {
+		exact, f := newSpySubscrption()
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.Wildcard(), pubsub.NotIn(9)))
+		t.p.Subscribe(f, pubsub.WithSegments(pubsub.Exact(0)))
+
+		// Like a generated TreeTraverser, yield 0 and the value for each
+		// field.
+		t.p.Publish("a", func(interface{}) pubsub.Paths {
+			return pubsub.PathsWithTraverser([]uint64{0, 1}, func(interface{}) pubsub.Paths {
+				return pubsub.FlatPaths([]uint64{0, 2})
+			})
+		})
+
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"a"}))
+		Expect(t, exact.data).To(Equal([]interface{}{"a"}))
+	})
+
+	o.Spec("it treats exact segments like a path", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.Exact(1), pubsub.AnyOf(2)))
+
+		trace := t.p.Explain("a", pubsub.LinearTreeTraverser([]uint64{1, 2}))
+
+		Expect(t, trace.Reached()).To(Equal(1))
+		Expect(t, trace.Steps[2].Pattern).To(Equal(""))
+	})
+
+	o.Spec("it explains pattern segments", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.Wildcard()))
+
+		trace := t.p.Explain("a", func(interface{}) pubsub.Paths {
+			return pubsub.PathsWithTraverser([]uint64{0, 1}, pubsub.LinearTreeTraverser(nil))
+		})
+
+		Expect(t, trace.String()).To(Equal("[]\n[0] missing\n[0] pattern(*) sub\n[1] missing\n[1] pattern(*) revisited\n"))
+	})
+
+	o.Spec("it removes pattern nodes on unsubscribe", func(t TPS) {
+		unsubscribe := t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.AnyOf(1, 2), pubsub.NotIn(3)))
+
+		var segments []string
+		t.p.Walk(func(_ []uint64, info pubsub.NodeInfo) bool {
+			if info.Subscriptions() > 0 {
+				for _, s := range info.Segments {
+					segments = append(segments, s.String())
+				}
+			}
+			return true
+		})
+		Expect(t, segments).To(Equal([]string{"{1,2}", "!{3}"}))
+
+		unsubscribe()
+		Expect(t, t.p.Stats().Nodes).To(Equal(1))
+	})
+
+	o.Spec("it normalizes segments", func(t TPS) {
+		Expect(t, pubsub.AnyOf(3, 1, 3).String()).To(Equal("{1,3}"))
+		Expect(t, pubsub.AnyOf(2, 2).String()).To(Equal("2"))
+		Expect(t, pubsub.NotIn().String()).To(Equal("*"))
+		Expect(t, pubsub.AnyOf().Match(1)).To(BeFalse())
+		Expect(t, pubsub.NotIn(1, 2).Match(2)).To(BeFalse())
+		Expect(t, pubsub.NotIn(1, 2).Match(3)).To(BeTrue())
+	})
+
+	o.Spec("it treats the zero value as a wildcard", func(t TPS) {
+		t.p.Subscribe(t.sub, pubsub.WithSegments(pubsub.PathSegment{}))
+
+		t.p.Publish("data", pubsub.LinearTreeTraverser([]uint64{7}))
+
+		Expect(t, pubsub.PathSegment{}.String()).To(Equal("*"))
+		Expect(t, t.subscription.data).To(Equal([]interface{}{"data"}))
+	})
+}
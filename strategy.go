@@ -0,0 +1,235 @@
+package pubsub
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-pubsub/internal/node"
+)
+
+// ShardStrategy selects which member of a shard group is handed the
+// published data. It is configured with WithShardStrategy or
+// WithShardStrategyFor and replaces both the random and the deterministic
+// selection.
+type ShardStrategy interface {
+	// Select returns the index of the member that is handed the data. For
+	// a Typed, the data is an interface{} holding a T. An index that is out
+	// of range selects no member. Select may be invoked concurrently and
+	// must not subscribe or unsubscribe.
+	Select(data interface{}, members []ShardMember) int
+}
+
+// ShardStrategyFunc is an adapter to use a function as a ShardStrategy.
+type ShardStrategyFunc func(data interface{}, members []ShardMember) int
+
+// Select implements ShardStrategy.
+func (f ShardStrategyFunc) Select(data interface{}, members []ShardMember) int {
+	return f(data, members)
+}
+
+// ShardMember describes a member of a shard group to a ShardStrategy. The
+// members are in the order of their deterministic routing names.
+type ShardMember struct {
+	// RoutingName is the member's deterministic routing name.
+	RoutingName string
+
+	// Weight is the weight the member subscribed WithRoutingWeight. It
+	// defaults to 1.
+	Weight float64
+
+	// Hash identifies the member. It is a hash of the routing name, or a
+	// unique value if the member does not have one. It does not change
+	// while the member is subscribed.
+	Hash uint64
+
+	// InFlight is the number of data points the member is handling or has
+	// buffered.
+	InFlight int
+
+	// Selected and Done are sequence numbers of the last time the member
+	// was selected and the last time it finished handling data. A higher
+	// number is more recent. They are 0 if it never was.
+	Selected uint64
+	Done     uint64
+}
+
+// sequence orders selections and completions across every PubSub. It
+// also provides the Hash of members without a routing name.
+var sequence uint64
+
+// WithShardStrategy configures a PubSub to select the member of each shard
+// group with the given ShardStrategy.
+func WithShardStrategy(st ShardStrategy) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		s.shardStrategy = st
+	})
+}
+
+// WithShardStrategyFor configures a PubSub to select the member of each
+// shard group with the given shard ID with the given ShardStrategy. It takes
+// precedence over WithShardStrategy.
+func WithShardStrategyFor(shardID string, st ShardStrategy) PubSubOption {
+	return pubsubConfigFunc(func(s *pubsubConfig) {
+		if s.shardStrategies == nil {
+			s.shardStrategies = make(map[string]ShardStrategy)
+		}
+		s.shardStrategies[shardID] = st
+	})
+}
+
+// RoundRobin returns a ShardStrategy that selects each member in turn. A
+// member that joins the shard group is selected next.
+func RoundRobin() ShardStrategy {
+	return ShardStrategyFunc(func(_ interface{}, members []ShardMember) int {
+		return minMember(members, func(m ShardMember) uint64 {
+			return m.Selected
+		})
+	})
+}
+
+// LeastRecentlyUsed returns a ShardStrategy that selects the member that
+// has gone the longest without being used. A member is used when it is
+// selected and when it finishes handling data.
+func LeastRecentlyUsed() ShardStrategy {
+	return ShardStrategyFunc(func(_ interface{}, members []ShardMember) int {
+		return minMember(members, func(m ShardMember) uint64 {
+			if m.Done > m.Selected {
+				return m.Done
+			}
+			return m.Selected
+		})
+	})
+}
+
+// LeastInFlight returns a ShardStrategy that selects the member that is
+// handling the fewest data points. For a subscription configured
+// WithBuffer, buffered data points are included. Ties are broken in turn.
+func LeastInFlight() ShardStrategy {
+	return ShardStrategyFunc(func(_ interface{}, members []ShardMember) int {
+		idx := -1
+		for i, m := range members {
+			if idx < 0 ||
+				m.InFlight < members[idx].InFlight ||
+				(m.InFlight == members[idx].InFlight && m.Selected < members[idx].Selected) {
+				idx = i
+			}
+		}
+		return idx
+	})
+}
+
+// StickyByKey returns a ShardStrategy that always selects the same member
+// for data with the same key. It uses rendezvous hashing, and so only about
+// 1/N of the keys move to a different member when a member joins or leaves
+// a shard group of N members. Each member's share of the keys is
+// proportional to its Weight.
+func StickyByKey(key func(data interface{}) string) ShardStrategy {
+	return ShardStrategyFunc(func(data interface{}, members []ShardMember) int {
+		h := fnv.New64a()
+		h.Write([]byte(key(data)))
+		hash := h.Sum64()
+
+		idx := -1
+		var best float64
+		for i, m := range members {
+			if score := rendezvousScore(hash, m.Hash, m.Weight); idx < 0 || score > best {
+				idx, best = i, score
+			}
+		}
+		return idx
+	})
+}
+
+// minMember returns the index of the first member with the lowest value.
+func minMember(members []ShardMember, value func(ShardMember) uint64) int {
+	idx := -1
+	var min uint64
+	for i, m := range members {
+		if v := value(m); idx < 0 || v < min {
+			idx, min = i, v
+		}
+	}
+	return idx
+}
+
+// shardStrategyFor returns the ShardStrategy for the shard ID or nil if
+// there is not one.
+func (c pubsubConfig) shardStrategyFor(shardID string) ShardStrategy {
+	if st, ok := c.shardStrategies[shardID]; ok {
+		return st
+	}
+	return c.shardStrategy
+}
+
+// tracks reports whether the shard or consumer group with the given name
+// uses a ShardStrategy.
+func (c pubsubConfig) tracks(name string) bool {
+	return name != "" && c.shardStrategyFor(name) != nil
+}
+
+// shardMembers describes each member of a shard group.
+func shardMembers[T any](ss []node.SubscriptionEnvelope) []ShardMember {
+	members := make([]ShardMember, len(ss))
+	for i, e := range ss {
+		sub := e.Meta.(*subscription[T])
+		members[i] = ShardMember{
+			RoutingName: e.DeterministicRoutingName(),
+			Weight:      sub.routingWeight,
+			Hash:        sub.routingHash,
+			InFlight:    sub.pending(),
+			Selected:    atomic.LoadUint64(&sub.selected),
+			Done:        atomic.LoadUint64(&sub.done),
+		}
+	}
+	return members
+}
+
+// selectMember selects a member of the shard group with the ShardStrategy.
+// If the visitor hands the data to the member, the selection is recorded
+// right away, so that the next item of a batch or a concurrent publish
+// selects with it in mind. If the member was selected by a concurrent
+// publish in the meantime, the selection is made again.
+func selectMember[T any](v visitor, st ShardStrategy, d T, ss []node.SubscriptionEnvelope) int64 {
+	for {
+		members := shardMembers[T](ss)
+		idx := int64(st.Select(d, members))
+		if idx < 0 || idx >= int64(len(ss)) || !v.selects() {
+			return idx
+		}
+
+		if idx = nextAvailable[T](v, ss, idx); idx < 0 {
+			return idx
+		}
+
+		if ss[idx].Meta.(*subscription[T]).markSelected(members[idx].Selected) {
+			return idx
+		}
+	}
+}
+
+// markSelected records that the subscription was selected by its shard
+// group. It reports false if the subscription was selected again since it
+// was last selected with the given sequence number.
+func (s *subscription[T]) markSelected(last uint64) bool {
+	return atomic.CompareAndSwapUint64(&s.selected, last, atomic.AddUint64(&sequence, 1))
+}
+
+// begin and end bracket each invocation of a tracked subscription.
+func (s *subscription[T]) begin() {
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+func (s *subscription[T]) end() {
+	atomic.AddInt64(&s.inFlight, -1)
+	atomic.StoreUint64(&s.done, atomic.AddUint64(&sequence, 1))
+}
+
+// pending returns the number of data points the subscription is handling
+// or has buffered.
+func (s *subscription[T]) pending() int {
+	n := int(atomic.LoadInt64(&s.inFlight))
+	if s.buffer != nil {
+		n += s.buffer.size()
+	}
+	return n
+}
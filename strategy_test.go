@@ -0,0 +1,183 @@
+package pubsub_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TSS struct {
+	*testing.T
+	order []string
+}
+
+func TestPubSubShardStrategies(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) *TSS {
+		return &TSS{T: t}
+	})
+
+	// subscribe adds a member that records its routing name in the order it
+	// was handed data.
+	subscribe := func(t *TSS, p *pubsub.PubSub, name string, opts ...pubsub.SubscribeOption) pubsub.Unsubscriber {
+		opts = append(opts, pubsub.WithShardID("group"), pubsub.WithDeterministicRouting(name))
+		return p.Subscribe(func(interface{}) {
+			t.order = append(t.order, name)
+		}, opts...)
+	}
+
+	publish := func(p *pubsub.PubSub, data ...interface{}) {
+		for _, d := range data {
+			p.Publish(d, pubsub.LinearTreeTraverser(nil))
+		}
+	}
+
+	o.Spec("it selects each member in turn", func(t *TSS) {
+		p := pubsub.New(pubsub.WithShardStrategy(pubsub.RoundRobin()))
+		subscribe(t, p, "a")
+		subscribe(t, p, "b")
+		subscribe(t, p, "c")
+
+		publish(p, 1, 2, 3, 4)
+		subscribe(t, p, "d")
+		publish(p, 5, 6)
+
+		Expect(t, t.order).To(Equal([]string{"a", "b", "c", "a", "d", "b"}))
+	})
+
+	o.Spec("it records each selection of a batch before the next one", func(t *TSS) {
+		strategies := []pubsub.ShardStrategy{
+			pubsub.RoundRobin(),
+			pubsub.LeastRecentlyUsed(),
+			pubsub.LeastInFlight(),
+		}
+		for _, st := range strategies {
+			t.order = nil
+			p := pubsub.New(pubsub.WithShardStrategy(st))
+			subscribe(t, p, "a")
+			subscribe(t, p, "b")
+			subscribe(t, p, "c")
+
+			p.PublishBatch([]interface{}{1, 2, 3, 4, 5, 6}, pubsub.LinearTreeTraverser(nil))
+
+			counts := make(map[string]int)
+			for _, m := range t.order {
+				counts[m]++
+			}
+			Expect(t, counts).To(Equal(map[string]int{"a": 2, "b": 2, "c": 2}))
+		}
+	})
+
+	o.Spec("it selects each member in turn for concurrent publishes", func(t *TSS) {
+		p := pubsub.New(pubsub.WithShardStrategy(pubsub.RoundRobin()))
+		counts := make([]int64, 3)
+		for i := range counts {
+			i := i
+			p.Subscribe(func(interface{}) {
+				atomic.AddInt64(&counts[i], 1)
+			}, pubsub.WithShardID("group"), pubsub.WithDeterministicRouting(fmt.Sprint(i)))
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 30; j++ {
+					p.Publish(j, pubsub.LinearTreeTraverser(nil))
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(t, counts).To(Equal([]int64{100, 100, 100}))
+	})
+
+	o.Spec("it selects the least recently used member", func(t *TSS) {
+		p := pubsub.New(pubsub.WithShardStrategy(pubsub.LeastRecentlyUsed()))
+		subscribe(t, p, "a")
+		subscribe(t, p, "b")
+
+		publish(p, 1, 2, 3)
+
+		Expect(t, t.order).To(Equal([]string{"a", "b", "a"}))
+	})
+
+	o.Spec("it selects the member with the least in flight", func(t *TSS) {
+		p := pubsub.New(pubsub.WithShardStrategy(pubsub.LeastInFlight()))
+		slow := newBlockingSubscription()
+		defer slow.release()
+		fast, f := newSpySubscrption()
+		p.Subscribe(slow.f, pubsub.WithShardID("group"), pubsub.WithBuffer(10, pubsub.DropNewest()))
+		p.Subscribe(f, pubsub.WithShardID("group"))
+
+		publish(p, 1)
+		<-slow.started
+		publish(p, 2, 3, 4)
+
+		Expect(t, fast.data).To(HaveLen(3))
+	})
+
+	o.Spec("it selects the same member for the same key", func(t *TSS) {
+		p := pubsub.New(pubsub.WithShardStrategy(pubsub.StickyByKey(func(data interface{}) string {
+			return data.(string)
+		})))
+		for i := 0; i < 5; i++ {
+			subscribe(t, p, fmt.Sprintf("member-%d", i))
+		}
+
+		for i := 0; i < 3; i++ {
+			publish(p, "x", "y", "z")
+		}
+
+		Expect(t, t.order[0:3]).To(Equal(t.order[3:6]))
+		Expect(t, t.order[0:3]).To(Equal(t.order[6:9]))
+	})
+
+	o.Spec("it uses the strategy configured for the shard ID", func(t *TSS) {
+		never := pubsub.ShardStrategyFunc(func(interface{}, []pubsub.ShardMember) int {
+			return -1
+		})
+		p := pubsub.New(
+			pubsub.WithShardStrategy(never),
+			pubsub.WithShardStrategyFor("group", pubsub.RoundRobin()),
+		)
+		subscribe(t, p, "a")
+		p.Subscribe(func(interface{}) {
+			t.order = append(t.order, "other")
+		}, pubsub.WithShardID("other"))
+
+		publish(p, 1)
+
+		Expect(t, t.order).To(Equal([]string{"a"}))
+	})
+
+	o.Spec("it describes each member", func(t *TSS) {
+		var members []pubsub.ShardMember
+		p := pubsub.New(pubsub.WithShardStrategy(pubsub.ShardStrategyFunc(func(_ interface{}, m []pubsub.ShardMember) int {
+			members = m
+			return 0
+		})))
+		subscribe(t, p, "b")
+		subscribe(t, p, "a", pubsub.WithRoutingWeight(2))
+
+		publish(p, 1, 2)
+
+		Expect(t, members).To(HaveLen(2))
+		Expect(t, members[0].RoutingName).To(Equal("a"))
+		Expect(t, members[0].Weight).To(Equal(2.0))
+		Expect(t, members[0].Selected > 0).To(BeTrue())
+		Expect(t, members[0].Done > members[0].Selected).To(BeTrue())
+		Expect(t, members[1].Weight).To(Equal(1.0))
+		Expect(t, members[1].Selected).To(Equal(uint64(0)))
+		Expect(t, members[0].Hash).To(Not(Equal(members[1].Hash)))
+	})
+}
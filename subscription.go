@@ -0,0 +1,219 @@
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// subscription is stored as the meta of each node.SubscriptionEnvelope. It
+// holds where the subscription resides in the subscription tree and its
+// place within a shard or consumer group. Moving a subscription (see
+// SubscriptionHandle.Update) replaces its record, while the subscriber is
+// shared by each record.
+type subscription[T any] struct {
+	*subscriber[T]
+
+	path          []uint64
+	shardID       string
+	routingName   string
+	routingHash   uint64
+	routingWeight float64
+	shardKey      func(interface{}) uint64
+	shardSeed     uint64
+	hasShardSeed  bool
+	group         string
+
+	// tracked is set when the subscription's shard or consumer group uses
+	// a ShardStrategy. The subscriber's counters are then kept up to date.
+	tracked bool
+}
+
+// subscriber holds everything PubSub needs to deliver to a subscriber.
+type subscriber[T any] struct {
+	inFlight  int64
+	selected  uint64
+	done      uint64
+	delivered int64
+	removed   int32
+	paused    int32
+
+	// reports and unsubscribed order the reports to the Metrics (see
+	// beginReport).
+	reports      int64
+	unsubscribed int32
+
+	id      uint64
+	f       func(ctx context.Context, data T) error
+	batch   func(ctx context.Context, data []T) error
+	buffer  *buffer[T]
+	gate    *replayGate[T]
+	current atomic.Pointer[subscription[T]]
+
+	atMostOnce        bool
+	recoverPanics     bool
+	deadLetterHandler DeadLetterHandler
+	interceptors      []DeliveryInterceptor
+	metrics           Metrics
+
+	// The fields below are set for a subscription that is removed
+	// automatically (see expireWith).
+	deadline      time.Time
+	clock         Clock
+	maxDeliveries int64
+	expire        func(RemovalReason)
+}
+
+// newSubscription creates a subscription record. Either f or batch is set.
+// A batch subscription is invoked by Publish with a single item.
+func newSubscription[T any](f func(ctx context.Context, data T) error, batch func(ctx context.Context, data []T) error, c subscribeConfig, pc pubsubConfig) *subscription[T] {
+	if f == nil {
+		f = func(ctx context.Context, data T) error {
+			return batch(ctx, []T{data})
+		}
+	}
+
+	sub := &subscriber[T]{
+		f:                 f,
+		batch:             batch,
+		atMostOnce:        c.atMostOnce,
+		recoverPanics:     pc.recoverPanics,
+		deadLetterHandler: pc.deadLetterHandler,
+		interceptors:      pc.deliveryInterceptors,
+		metrics:           pc.metrics,
+	}
+
+	if c.replay && pc.historyEnabled() {
+		sub.gate = &replayGate[T]{}
+	}
+
+	s := sub.place(c, pc)
+	sub.current.Store(s)
+
+	if c.bufferSize > 0 {
+		sub.buffer = newBuffer[T](c.bufferSize, c.dropPolicy, sub.dropHandler(c.dropHandler))
+		go func() {
+			sub.buffer.run(func(ctx context.Context, d T) {
+				sub.current.Load().invoke(ctx, d)
+			})
+
+			if c.bufferStopped != nil {
+				c.bufferStopped()
+			}
+		}()
+	}
+
+	return s
+}
+
+// place creates a record for the subscriber that places it according to
+// the config.
+func (s *subscriber[T]) place(c subscribeConfig, pc pubsubConfig) *subscription[T] {
+	ss := &subscription[T]{
+		subscriber:    s,
+		path:          segmentValues(c.segments),
+		shardID:       c.shardID,
+		routingName:   c.deterministicRoutingName,
+		routingHash:   routingHash(c.deterministicRoutingName),
+		routingWeight: c.routingWeight,
+		shardKey:      c.shardKey,
+		shardSeed:     c.shardSeed,
+		hasShardSeed:  c.hasShardSeed,
+		group:         c.group,
+		tracked:       pc.tracks(c.shardID) || pc.tracks(c.group),
+	}
+
+	if c.deterministicRoutingName == "" {
+		ss.routingHash = mix(atomic.AddUint64(&sequence, 1))
+	}
+
+	if ss.routingWeight == 0 {
+		ss.routingWeight = 1
+	}
+
+	return ss
+}
+
+// deliverLive hands published data with the given sequence number to the
+// subscriber. It is held back or discarded while the subscription replays
+// the history.
+func (s *subscription[T]) deliverLive(ctx context.Context, d T, seq uint64) {
+	if s.gate != nil && s.gate.hold(ctx, d, seq) {
+		return
+	}
+
+	s.deliver(ctx, d)
+}
+
+// deliver hands the data to the subscriber, either directly or via its
+// buffer.
+func (s *subscription[T]) deliver(ctx context.Context, d T) {
+	if s.buffer != nil {
+		s.buffer.write(ctx, d)
+		return
+	}
+
+	s.invoke(ctx, d)
+}
+
+// invoke invokes the subscriber unless it has been removed or reached its
+// maximum number of deliveries. A returned error or a recovered panic is
+// handed to the DeadLetterHandler.
+func (s *subscription[T]) invoke(ctx context.Context, d T) {
+	if s.isRemoved() {
+		return
+	}
+
+	n, last := s.take(1)
+	if n == 0 {
+		return
+	}
+	if last {
+		defer s.expire(RemovedByMaxDeliveries)
+	}
+
+	if s.tracked {
+		s.begin()
+		defer s.end()
+	}
+
+	if s.recoverPanics {
+		defer s.recoverPanic(d, false)
+	}
+
+	err := s.measure(false, func() error {
+		return s.call(ctx, d)
+	})
+	if err != nil {
+		s.deadLetter(d, err)
+	}
+}
+
+// envelopeFunc is stored as the Subscription of the
+// node.SubscriptionEnvelope.
+func (s *subscription[T]) envelopeFunc(data interface{}) {
+	d, _ := data.(T)
+	s.deliver(context.Background(), d)
+}
+
+// remove marks the subscription as removed. It reports whether this was the
+// first time it was invoked.
+func (s *subscriber[T]) remove() bool {
+	if !atomic.CompareAndSwapInt32(&s.removed, 0, 1) {
+		return false
+	}
+
+	if s.buffer != nil {
+		s.buffer.stop()
+	}
+
+	return true
+}
+
+func (s *subscriber[T]) isRemoved() bool {
+	return atomic.LoadInt32(&s.removed) == 1
+}
+
+func (s *subscriber[T]) isPaused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
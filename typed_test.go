@@ -0,0 +1,110 @@
+package pubsub_test
+
+import (
+	"sync"
+	"testing"
+
+	"code.cloudfoundry.org/go-pubsub"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+)
+
+type TT struct {
+	*testing.T
+	p *pubsub.Typed[*typedData]
+}
+
+type typedData struct {
+	a uint64
+	b uint64
+}
+
+func typedDataTraverse(d *typedData) pubsub.TypedPaths[*typedData] {
+	return pubsub.TypedPathsWithTraverser([]uint64{0, d.a}, typedDataTraverseB)
+}
+
+func typedDataTraverseB(d *typedData) pubsub.TypedPaths[*typedData] {
+	return pubsub.TypedPathsWithTraverser([]uint64{0, d.b}, func(*typedData) pubsub.TypedPaths[*typedData] {
+		return pubsub.TypedFlatPaths[*typedData](nil)
+	})
+}
+
+func TestTyped(t *testing.T) {
+	t.Parallel()
+	o := onpar.New()
+	defer o.Run(t)
+	o.BeforeEach(func(t *testing.T) TT {
+		return TT{
+			T: t,
+			p: pubsub.NewTyped[*typedData](),
+		}
+	})
+
+	o.Spec("it writes to the correct subscription", func(t TT) {
+		sub1, f1 := newTypedSpySubscription()
+		sub2, f2 := newTypedSpySubscription()
+		sub3, f3 := newTypedSpySubscription()
+
+		t.p.Subscribe(f1, pubsub.WithPath([]uint64{1, 2}))
+		t.p.Subscribe(f2, pubsub.WithPath([]uint64{1, 3}))
+		t.p.Subscribe(f3, pubsub.WithPath([]uint64{1}))
+
+		data := &typedData{a: 1, b: 2}
+		t.p.Publish(data, typedDataTraverse)
+
+		Expect(t, sub1.data).To(HaveLen(1))
+		Expect(t, sub2.data).To(HaveLen(0))
+		Expect(t, sub3.data).To(HaveLen(1))
+		Expect(t, sub1.data[0]).To(Equal(data))
+	})
+
+	o.Spec("it does not write to a subscription after it unsubscribes", func(t TT) {
+		sub, f := newTypedSpySubscription()
+		unsubscribe := t.p.Subscribe(f, pubsub.WithPath([]uint64{1, 2}))
+		unsubscribe()
+
+		t.p.Publish(&typedData{a: 1, b: 2}, typedDataTraverse)
+		Expect(t, sub.data).To(HaveLen(0))
+	})
+
+	o.Spec("it uses the typed helper traversers", func(t TT) {
+		sub, f := newTypedSpySubscription()
+		t.p.Subscribe(f, pubsub.WithPath([]uint64{1, 2}))
+
+		t.p.Publish(&typedData{}, pubsub.TypedLinearTreeTraverser[*typedData]([]uint64{1, 2}))
+		t.p.Publish(&typedData{}, func(*typedData) pubsub.TypedPaths[*typedData] {
+			return pubsub.TypedCombinePaths(
+				pubsub.TypedFlatPaths[*typedData]([]uint64{3}),
+				pubsub.TypedPathAndTraversers([]pubsub.TypedPathAndTraverser[*typedData]{
+					{Path: 1, Traverser: pubsub.TypedLinearTreeTraverser[*typedData]([]uint64{2})},
+				}),
+			)
+		})
+
+		Expect(t, sub.data).To(HaveLen(2))
+	})
+
+	o.Spec("it shares the untyped PubSub API", func(t TT) {
+		var p *pubsub.PubSub = pubsub.NewTyped[interface{}]()
+		sub, f := newSpySubscrption()
+		p.Subscribe(pubsub.Subscription(f), pubsub.WithPath([]uint64{1}))
+		p.Publish("data", pubsub.LinearTreeTraverser([]uint64{1}))
+
+		Expect(t, sub.data).To(Equal([]interface{}{"data"}))
+	})
+}
+
+type typedSpySubscription struct {
+	mu   sync.Mutex
+	data []*typedData
+}
+
+func newTypedSpySubscription() (*typedSpySubscription, func(*typedData)) {
+	s := &typedSpySubscription{}
+	return s, func(data *typedData) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.data = append(s.data, data)
+	}
+}